@@ -0,0 +1,336 @@
+/*
+Package asm assembles and disassembles programs for the stack ISAs, f3, f5
+and f6.
+
+Source has one op per line, optionally after a label, with comments after
+';' or '#':
+
+	loop:	PUSH @loop	; offset back to loop for the JNZ
+		PUSH 1
+		JNZ
+		.byte 0x3f	; any byte, e.g. the filler
+
+Mnemonics are those in the ISA's table of ops, in any case. Only PUSH and
+SHIFT_PUSH take an operand. SHIFT_PUSH takes a nibble, 0 to 15. PUSH takes
+any value from -128 to 255 (the stack holds int8s, so 255 is -1) and becomes
+a single PUSH if it fits in the sign extended nibble, and a PUSH of the high
+nibble followed by a SHIFT_PUSH of the low one otherwise.
+
+Operands are sums and differences of numbers, labels, '.' (the address of
+the current op) and @label. A label is the address of the op after it,
+counting from the start of the program, so only differences between labels
+mean anything once the program is in a universe. @label is the offset of the
+label from wherever the next op that takes an address from the stack will
+add it to: the op after that op. Those ops are JNZ and COPY, and in f6 LOAD,
+STORE, SRH and SWH, which all add an offset to the pc after them.
+*/
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"links.org/bf/isa/f3"
+	"links.org/bf/isa/f5"
+	"links.org/bf/isa/f6"
+	"links.org/bf/soup"
+)
+
+// The ops every dialect shares.
+const (
+	PUSH       = 0x00
+	SHIFT_PUSH = 0x10
+)
+
+// Dialect is the ops of one of the stack ISAs.
+type Dialect struct {
+	Name      string
+	Ops       map[string]uint8 // Other than PUSH and SHIFT_PUSH
+	Addresses map[uint8]bool   // Ops that add an offset from the stack to the pc
+
+	mnemonics map[uint8]string
+}
+
+// newDialect takes the ops from an ISA's table.
+func newDialect(name string, t *soup.OpTable) *Dialect {
+	d := &Dialect{Name: name, Ops: make(map[string]uint8), Addresses: make(map[uint8]bool), mnemonics: make(map[uint8]string)}
+	for _, op := range t.Ops {
+		if op.Nibble || op.Mnemonic == "" {
+			continue
+		}
+		d.Ops[op.Mnemonic] = op.Code
+		d.mnemonics[op.Code] = op.Mnemonic
+		if op.Address {
+			d.Addresses[op.Code] = true
+		}
+	}
+	return d
+}
+
+var dialects = map[string]*Dialect{
+	"f3": newDialect("f3", f3.Ops),
+	"f5": newDialect("f5", f5.Ops),
+	"f6": newDialect("f6", f6.Ops),
+}
+
+// Lookup returns the named dialect.
+func Lookup(name string) (*Dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("no assembler for ISA %q, only %s", name, strings.Join(Names(), ", "))
+	}
+	return d, nil
+}
+
+// MustLookup is Lookup for a dialect that is known to exist.
+func MustLookup(name string) *Dialect {
+	d, err := Lookup(name)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Names lists the dialects.
+func Names() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Error is an error in the source, at a line counting from 1.
+type Error struct {
+	Line int
+	Err  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// instruction is a line of source with an op.
+type instruction struct {
+	line    int
+	op      uint8
+	operand string // PUSH and SHIFT_PUSH
+	bytes   []uint8
+	size    int // Of a PUSH, which grows until it fits
+	addr    int
+}
+
+// Assemble assembles src, see the package comment.
+func (d *Dialect) Assemble(src io.Reader) ([]uint8, error) {
+	var is []*instruction
+	labels := make(map[string]int) // Label to index of the instruction after it
+	sc := bufio.NewScanner(src)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexAny(line, ";#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, ":"); i >= 0 {
+			label := strings.TrimSpace(line[:i])
+			if !isLabel(label) {
+				return nil, &Error{n, fmt.Sprintf("bad label %q", label)}
+			}
+			if _, ok := labels[label]; ok {
+				return nil, &Error{n, fmt.Sprintf("label %s defined twice", label)}
+			}
+			labels[label] = len(is)
+			line = strings.TrimSpace(line[i+1:])
+		}
+		if line == "" {
+			continue
+		}
+		mnemonic, operand := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			mnemonic, operand = line[:i], strings.TrimSpace(line[i:])
+		}
+		mnemonic = strings.ToUpper(mnemonic)
+		in := &instruction{line: n, operand: operand, size: 1}
+		switch mnemonic {
+		case "PUSH", "SHIFT_PUSH":
+			if operand == "" {
+				return nil, &Error{n, mnemonic + " needs an operand"}
+			}
+			in.op = PUSH
+			if mnemonic == "SHIFT_PUSH" {
+				in.op = SHIFT_PUSH
+			}
+		case ".BYTE":
+			for _, f := range strings.Split(operand, ",") {
+				v, err := strconv.ParseInt(strings.TrimSpace(f), 0, 16)
+				if err != nil || v < 0 || v > 255 {
+					return nil, &Error{n, fmt.Sprintf("bad byte %q", f)}
+				}
+				in.bytes = append(in.bytes, uint8(v))
+			}
+			in.size = len(in.bytes)
+		default:
+			op, ok := d.Ops[mnemonic]
+			if !ok {
+				return nil, &Error{n, fmt.Sprintf("no op %s in %s", mnemonic, d.Name)}
+			}
+			if operand != "" {
+				return nil, &Error{n, mnemonic + " takes no operand"}
+			}
+			in.op = op
+		}
+		is = append(is, in)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// Grow the PUSHes that don't fit in one op until the layout settles
+	for {
+		addr := 0
+		for _, in := range is {
+			in.addr = addr
+			addr += in.size
+		}
+		grew := false
+		for k, in := range is {
+			if in.bytes != nil || in.op != PUSH || in.size == 2 {
+				continue
+			}
+			v, err := d.eval(is, labels, k, addr)
+			if err != nil {
+				return nil, err
+			}
+			if int8(v) < -8 || int8(v) > 7 {
+				in.size = 2
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	var out []uint8
+	end := 0
+	if len(is) > 0 {
+		end = is[len(is)-1].addr + is[len(is)-1].size
+	}
+	for k, in := range is {
+		switch {
+		case in.bytes != nil:
+			out = append(out, in.bytes...)
+		case in.op == PUSH || in.op == SHIFT_PUSH:
+			v, err := d.eval(is, labels, k, end)
+			if err != nil {
+				return nil, err
+			}
+			if in.op == SHIFT_PUSH {
+				if v < 0 || v > 15 {
+					return nil, &Error{in.line, fmt.Sprintf("SHIFT_PUSH %d isn't a nibble", v)}
+				}
+				out = append(out, SHIFT_PUSH|uint8(v))
+				continue
+			}
+			if v < -128 || v > 255 {
+				return nil, &Error{in.line, fmt.Sprintf("PUSH %d doesn't fit in a byte", v)}
+			}
+			b := uint8(v)
+			if in.size == 1 {
+				out = append(out, PUSH|b&0x0f)
+			} else {
+				out = append(out, PUSH|b>>4, SHIFT_PUSH|b&0x0f)
+			}
+		default:
+			out = append(out, in.op)
+		}
+	}
+	return out, nil
+}
+
+func isLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// eval evaluates the operand of instruction k. end is the address after the
+// last instruction, which labels at the end refer to.
+func (d *Dialect) eval(is []*instruction, labels map[string]int, k int, end int) (int, error) {
+	in := is[k]
+	addr := func(label string) (int, error) {
+		i, ok := labels[label]
+		if !ok {
+			return 0, &Error{in.line, fmt.Sprintf("no label %s", label)}
+		}
+		if i == len(is) {
+			return end, nil
+		}
+		return is[i].addr, nil
+	}
+	// The pc the next op taking an address will add the offset to
+	base := func() (int, error) {
+		for _, next := range is[k+1:] {
+			if next.bytes == nil && d.Addresses[next.op] {
+				return next.addr + 1, nil
+			}
+		}
+		return 0, &Error{in.line, "no op after it to take the address"}
+	}
+
+	expr := strings.ReplaceAll(in.operand, " ", "")
+	v := 0
+	for expr != "" {
+		sign := 1
+		switch expr[0] {
+		case '+':
+			expr = expr[1:]
+		case '-':
+			sign = -1
+			expr = expr[1:]
+		}
+		term := expr
+		if i := strings.IndexAny(expr, "+-"); i >= 0 {
+			term, expr = expr[:i], expr[i:]
+		} else {
+			expr = ""
+		}
+		var t int
+		var err error
+		switch {
+		case term == ".":
+			t = in.addr
+		case strings.HasPrefix(term, "@"):
+			if t, err = addr(term[1:]); err == nil {
+				var b int
+				b, err = base()
+				t -= b
+			}
+		case isLabel(term):
+			t, err = addr(term)
+		default:
+			var n int64
+			n, err = strconv.ParseInt(term, 0, 32)
+			if err != nil {
+				err = &Error{in.line, fmt.Sprintf("bad operand %q", in.operand)}
+			}
+			t = int(n)
+		}
+		if err != nil {
+			return 0, err
+		}
+		v += sign * t
+	}
+	return v, nil
+}
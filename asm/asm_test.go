@@ -0,0 +1,91 @@
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"links.org/bf/isa/f5"
+	"links.org/bf/isa/f6"
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+func assemble(t *testing.T, name string, src string) []uint8 {
+	d, err := Lookup(name)
+	assert.NilError(t, err)
+	b, err := d.Assemble(strings.NewReader(src))
+	assert.NilError(t, err)
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(1)
+	u := make([]uint8, 4096)
+	for i := range u {
+		u[i] = uint8(r.Intn(256))
+	}
+	for _, name := range Names() {
+		d, _ := Lookup(name)
+		var b bytes.Buffer
+		assert.NilError(t, d.Disassemble(&b, u, 100, len(u)))
+		assert.DeepEqual(t, assemble(t, name, b.String()), append(append([]uint8{}, u[100:]...), u[:100]...))
+	}
+}
+
+func TestLabels(t *testing.T) {
+	c := &soup.Config{SLen: 16, ILimit: 100, Strict: true}
+
+	// Count down from 3 in f6
+	u := make(soup.Universe, 1024)
+	u.Fill(0x3f)
+	copy(u[10:], assemble(t, "f6", `
+		PUSH 3
+	loop:	DEC
+		DUP
+		PUSH @loop	; back to DEC
+		SWAP
+		JNZ
+	`))
+	var p soup.Profile
+	f6.New(c).RunProfiled(u, 10, nil, &p)
+	assert.Equal(t, p.Ops[f6.DEC], uint64(3))
+
+	// f5 copies a cell past the end of a long program
+	src := `
+		PUSH @data
+		PUSH copy - data
+		COPY
+	data:	.byte 0x2a
+		.byte 0x30, 0x30, 0x30, 0x30, 0x30, 0x30, 0x30, 0x30, 0x30, 0x30
+	copy:	.byte 0x30
+	`
+	b := assemble(t, "f5", src)
+	assert.Equal(t, len(b), 1+2+1+1+10+1)
+	u.Fill(0x30)
+	copy(u[10:], b)
+	f5.New(c).Run(u, 10)
+	assert.Equal(t, u[10+len(b)-1], uint8(0x2a))
+
+	assert.DeepEqual(t, assemble(t, "f5", "PUSH -1\nPUSH 255\nPUSH 100 ; two ops\nshift_push 15"), []uint8{0x0f, 0x0f, 0x06, 0x14, 0x1f})
+}
+
+func TestErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"PUSH 1\nPUSH nowhere": "line 2: no label nowhere",
+		"COPY":                 "no op COPY in f6",
+		"SHIFT_PUSH 16":        "isn't a nibble",
+		"PUSH 256":             "doesn't fit",
+		"PUSH @a\na: INC":      "no op after it",
+		"a: INC\na: DEC":       "label a defined twice",
+		"INC 3":                "takes no operand",
+		".byte 0x100":          "bad byte",
+		"9a: INC":              "bad label",
+		"PUSH 1 + 2 - 0x1g":    "bad operand",
+	} {
+		d, _ := Lookup("f6")
+		_, err := d.Assemble(strings.NewReader(src))
+		assert.ErrorContains(t, err, want, src)
+	}
+}
@@ -0,0 +1,51 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+
+	"links.org/bf/soup"
+)
+
+// Disassemble writes n ops of u from start, wrapping around the end, as
+// source that assembles back to the same bytes. Each line has a comment
+// with the op's address and code, and, after a run of PUSH and SHIFT_PUSH,
+// the value it leaves on top of the stack.
+func (d *Dialect) Disassemble(w io.Writer, u []uint8, start int, n int) error {
+	top := 0 // Of the stack, while pushing
+	pushing := false
+	for i := 0; i < n; i++ {
+		addr := (start + i) % len(u)
+		op := u[addr]
+		var value string
+		switch {
+		case op&0xf0 == PUSH:
+			top = int(soup.SignExtend(op & 0x0f))
+			pushing = true
+		case op&0xf0 == SHIFT_PUSH:
+			if pushing {
+				top = int(int8(top<<4) + int8(op&0x0f))
+				value = fmt.Sprintf(" = %d", top)
+			}
+		default:
+			pushing = false
+		}
+		if _, err := fmt.Fprintf(w, "\t%-16s; %d: %02x%s\n", d.Mnemonic(op), addr, op, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mnemonic gives op as a line of source, with its operand if it has one.
+func (d *Dialect) Mnemonic(op uint8) string {
+	switch {
+	case op&0xf0 == PUSH:
+		return fmt.Sprintf("PUSH %d", soup.SignExtend(op&0x0f))
+	case op&0xf0 == SHIFT_PUSH:
+		return fmt.Sprintf("SHIFT_PUSH %d", op&0x0f)
+	case d.mnemonics[op] != "":
+		return d.mnemonics[op]
+	}
+	return fmt.Sprintf(".byte 0x%02x", op)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"math/rand"
+
+	"pgregory.net/rand"
 )
 
 /*
@@ -175,25 +177,25 @@ const mutation_rate = 32000
 const code_chars = "><+-.,[]*}"
 
 func mutate(program *[plen]uint8, programs *[nprograms][plen]uint8) {
-	r := rand.Intn(5)
+	r := rng.Intn(5)
 	switch r {
 	case 0:
-		program[rand.Intn(plen)] = code_chars[rand.Intn(len(code_chars))]
+		program[rng.Intn(plen)] = code_chars[rng.Intn(len(code_chars))]
 	case 1:
-		program[rand.Intn(plen)] = uint8(rand.Intn(256))
+		program[rng.Intn(plen)] = uint8(rng.Intn(256))
 	case 2:
-		n := rand.Intn(plen) + 1
+		n := rng.Intn(plen) + 1
 		var tmp [plen]uint8
 		copy(tmp[:], program[:n])
 		copy(program[:], program[n:])
 		copy(program[plen-n:], tmp[:])
 	case 3:
-		n := rand.Intn(plen)
-		p := rand.Intn(nprograms)
+		n := rng.Intn(plen)
+		p := rng.Intn(nprograms)
 		copy(program[n:], programs[p][n:])
 	case 4:
-		n := rand.Intn(plen)
-		p := rand.Intn(nprograms)
+		n := rng.Intn(plen)
+		p := rng.Intn(nprograms)
 		copy(program[:n], programs[p][:n])
 	}
 }
@@ -214,11 +216,11 @@ func fix(program *[plen]uint8) {
 				}
 			}
 			if j >= plen {
-				if i == plen-1 || rand.Intn(2) == 0 {
-					program[i] = uint8(rand.Intn(256))
+				if i == plen-1 || rng.Intn(2) == 0 {
+					program[i] = uint8(rng.Intn(256))
 					i--
 				} else {
-					t := rand.Intn(plen - i - 1)
+					t := rng.Intn(plen - i - 1)
 					program[i+t+1] = ']'
 					i = t + i
 				}
@@ -237,11 +239,11 @@ func fix(program *[plen]uint8) {
 				}
 			}
 			if j < 0 {
-				if i == 0 || rand.Intn(2) == 0 {
-					program[i] = uint8(rand.Intn(256))
+				if i == 0 || rng.Intn(2) == 0 {
+					program[i] = uint8(rng.Intn(256))
 					i--
 				} else {
-					t := rand.Intn(i)
+					t := rng.Intn(i)
 					program[t] = '['
 					i = t - 1
 				}
@@ -250,12 +252,19 @@ func fix(program *[plen]uint8) {
 	}
 }
 
+var rng *rand.Rand
+
 func main() {
-	//rand.Seed(1)
+	seed := flag.Uint64("seed", 0, "random seed (0 picks one at random)")
+	flag.Parse()
+	for *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	rng = rand.New(*seed)
 	var programs [nprograms][plen]uint8
 	for i := 0; i < nprograms; i++ {
 		for j := 0; j < plen; j++ {
-			programs[i][j] = uint8(rand.Intn(256))
+			programs[i][j] = uint8(rng.Intn(256))
 		}
 	}
 	showp(programs)
@@ -273,11 +282,11 @@ func main() {
 	for {
 		m++
 		if m > mutation_rate {
-			mutate(&programs[rand.Intn(nprograms)], &programs)
+			mutate(&programs[rng.Intn(nprograms)], &programs)
 			m = 0
 		}
-		p1 := rand.Intn(nprograms)
-		p2 := rand.Intn(nprograms)
+		p1 := rng.Intn(nprograms)
+		p2 := rng.Intn(nprograms)
 
 		var merged [plen * 2]uint8
 		copy(merged[:plen], programs[p1][:plen])
@@ -294,6 +303,7 @@ func main() {
 		if n++; n > 1000000 {
 			fmt.Printf("\033c")
 			showp(programs)
+			fmt.Printf("seed: %d\n", *seed)
 			//	fmt.Printf("********************\n")
 			n = 0
 		}
@@ -3,7 +3,8 @@
 
 package main
 
-func graphics(_ *[65536]uint8) {
-	// Sleep forever
-	select {}
+import "links.org/bf/soup"
+
+func graphics(s *soup.Soup) {
+	<-s.Done()
 }
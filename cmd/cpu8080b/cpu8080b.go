@@ -1,37 +1,44 @@
 package main
 
 import (
-	"encoding/binary"
+	"flag"
 	"fmt"
-	"math/rand"
 	"os"
 	"time"
 
 	"github.com/GinjaNinja32/go-i8080"
+	"links.org/bf/soup"
+	"pgregory.net/rand"
 )
 
 const REGION_MASK = uint16(0xfff0)
 const TOP_BIT = ^REGION_MASK & ((^REGION_MASK) >> 1)
 
-const ULEN = 0x10000
-const ILIMIT = 1_000                // clocks
-const MUTATION_RATE = 4_000_000_000 // Higher is less mutation
-const RUNNERS = 16
+// The 8080 can address at most 64K, smaller universes wrap.
+const MAX_ULEN = 0x10000
 
-type RAM [ULEN]byte
+var cfg = soup.Config{
+	ULen:         MAX_ULEN,
+	ILimit:       1_000, // clocks
+	MutationRate: 0,     // Off, was 4_000_000_000 per op
+	Runners:      16,
+	ShowLen:      4096,
+}
+
+type RAM []byte
 
 type CPUWithRAM struct {
 	i8080.CPU
-	ram  *RAM
+	ram  RAM
 	base uint16
 }
 
-func (r *RAM) Read(addr uint16) uint8 {
-	return r[addr]
+func (r RAM) Read(addr uint16) uint8 {
+	return r[int(addr)%len(r)]
 }
 
-func (r *RAM) Write(addr uint16, data uint8) {
-	r[addr] = data
+func (r RAM) Write(addr uint16, data uint8) {
+	r[int(addr)%len(r)] = data
 }
 
 /*
@@ -70,7 +77,7 @@ func (c *CPUWithRAM) run(pc uint16) uint64 {
 	for {
 		n := c.Step()
 		t += n
-		if c.Halted || t > ILIMIT {
+		if c.Halted || t > uint64(cfg.ILimit) {
 			return t
 		}
 		if n == 0 {
@@ -79,32 +86,31 @@ func (c *CPUWithRAM) run(pc uint16) uint64 {
 	}
 }
 
-func runner(cpu *CPUWithRAM, generation *uint64, n_ops *uint64) {
-	t := uint64(0)
-	for {
-		n := cpu.run(uint16(rand.Intn(ULEN)))
-		*n_ops += uint64(n)
-		t += n
-		for t > MUTATION_RATE && false {
-			//cpu.ram[rand.Intn(ULEN)] ^= uint8(1) << rand.Intn(8)
-			cpu.ram[rand.Intn(ULEN)] = uint8(rand.Intn(256))
-			t -= MUTATION_RATE
-		}
-		*generation++
+type isa struct{}
+
+func (isa) Run(universe []uint8, pc int) int {
+	cpu := CPUWithRAM{ram: universe}
+	return int(cpu.run(uint16(pc)))
+}
+
+func (isa) Glyph(op uint8) string {
+	if op >= 0x20 && op < 0x7f {
+		return string(rune(op))
 	}
+	return "."
 }
 
-var show_off = 0
+func (isa) RandomOp(r *rand.Rand) uint8 { return uint8(r.Intn(256)) }
 
-const SHOW_LEN = 4096
+var show_off = 0
 
-func showp(ram *[ULEN]byte) {
-	//show_off += SHOW_LEN
-	if show_off >= ULEN {
-		show_off -= ULEN
+func showp(ram RAM) {
+	//show_off += cfg.ShowLen
+	if show_off >= len(ram) {
+		show_off -= len(ram)
 	}
-	for i := 0; i < SHOW_LEN; i++ {
-		b := ram[(i+show_off)%ULEN]
+	for i := 0; i < cfg.ShowLen; i++ {
+		b := ram[(i+show_off)%len(ram)]
 		/*
 			if b >= 0x20 && b < 0x7f {
 				fmt.Printf("%c", b)
@@ -123,61 +129,39 @@ func showp(ram *[ULEN]byte) {
 }
 
 func main() {
+	cfg.RegisterFlags(flag.CommandLine)
+	if err := soup.ParseFlags(flag.CommandLine, os.Args[1:], &cfg); err != nil {
+		panic(err)
+	}
+	if cfg.ULen > MAX_ULEN {
+		panic(fmt.Sprintf("ulen %d is more than the 8080 can address", cfg.ULen))
+	}
+
 	f := fmt.Sprintf("logs/cpu8080.log.%s.%s", "", time.Now().Format("2006-01-02-15:04:05"))
-	log, err := os.Create(f)
+	log, err := soup.NewLogger(f, "8080", &cfg)
 	if err != nil {
 		panic(err)
 	}
 	defer log.Close()
 
-	binary.Write(log, binary.LittleEndian, uint64(ULEN))
-	binary.Write(log, binary.LittleEndian, uint64(0)) // SLEN
-	binary.Write(log, binary.LittleEndian, uint64(ILIMIT))
-	binary.Write(log, binary.LittleEndian, uint64(MUTATION_RATE))
-	binary.Write(log, binary.LittleEndian, uint64(RUNNERS))
-
-	ram := RAM{}
-
-	for i := 0; i < ULEN; i++ {
-		//universe[i] = 0x3f
-		ram[i] = uint8(rand.Intn(256))
-		//mutate(&universe)
-	}
-
-	var generation uint64
-	var n_ops uint64
-	for i := 0; i < RUNNERS; i++ {
-		cpu_with_ram := CPUWithRAM{ram: &ram}
-		go runner(&cpu_with_ram, &generation, &n_ops)
-	}
+	s := soup.NewSoup(isa{}, &cfg)
+	s.Log = log
+	s.PerOp = true
+	s.Universe.Randomize(s.ISA, s.Rand)
+	s.Start()
 
-	go func() {
-		p_n_ops := uint64(0)
-		p_generation := uint64(0)
-		t := time.Now()
-		for {
-			t2 := time.Now()
-			var u2 [ULEN]byte
-			copy(u2[:], ram[:])
-			//dump(log, generation, n_ops, &u2)
-			if generation != p_generation {
-				fmt.Println("\033c", generation, n_ops, generation-p_generation, n_ops-p_n_ops, float64(n_ops-p_n_ops)/t2.Sub(t).Seconds(), (n_ops-p_n_ops)/(generation-p_generation))
-			} else {
-				fmt.Println("\033c", generation, n_ops, generation-p_generation, n_ops-p_n_ops)
-			}
-			t = t2
-			p_n_ops = n_ops
-			p_generation = generation
-			showp(&u2)
-			/*
-				for i := 2; i < 16; i++ {
-					showngrams(&u2, i)
-					fmt.Print("\n")
-				}
-			*/
-			time.Sleep(1 * time.Second)
+	u2 := make(soup.Universe, cfg.ULen)
+	for {
+		generation, n_ops := s.Snapshot(u2)
+		st := s.Sample(u2, generation, n_ops)
+		if !cfg.Quiet {
+			fmt.Println("\033c", generation, n_ops, st.Generations, st.Ops, st.OpsPerSec, uint64(st.OpsPerRun))
+			showp(RAM(u2))
 		}
-	}()
-
-	select {}
+		select {
+		case <-s.Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
 }
@@ -18,6 +18,7 @@ cheat <1> -> <1>            copy <1> to <1> + PLEN              0000 000a
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"time"
@@ -183,31 +184,31 @@ func showp(programs [NPROGRAMS][PLEN]uint8) {
 }
 
 func mutate(program *[PLEN]uint8, programs *[NPROGRAMS][PLEN]uint8) {
-	r := rand.Intn(7)
+	r := rng.Intn(7)
 	switch r {
 	case 0:
-		program[rand.Intn(PLEN)] = uint8(rand.Intn(10)) + 1
+		program[rng.Intn(PLEN)] = uint8(rng.Intn(10)) + 1
 	case 1:
-		program[rand.Intn(PLEN)] = uint8(rand.Intn(256))
+		program[rng.Intn(PLEN)] = uint8(rng.Intn(256))
 	case 2:
-		n := rand.Intn(PLEN) + 1
+		n := rng.Intn(PLEN) + 1
 		var tmp [PLEN]uint8
 		copy(tmp[:], program[:n])
 		copy(program[:], program[n:])
 		copy(program[PLEN-n:], tmp[:])
 	case 3:
-		n := rand.Intn(PLEN)
-		p := rand.Intn(NPROGRAMS)
+		n := rng.Intn(PLEN)
+		p := rng.Intn(NPROGRAMS)
 		copy(program[n:], programs[p][n:])
 	case 4:
-		n := rand.Intn(PLEN)
-		p := rand.Intn(NPROGRAMS)
+		n := rng.Intn(PLEN)
+		p := rng.Intn(NPROGRAMS)
 		copy(program[:n], programs[p][:n])
 	case 5:
-		n := rand.Intn(PLEN)
+		n := rng.Intn(PLEN)
 		copy(program[n:], program[n+1:])
 	case 6:
-		n := rand.Intn(PLEN)
+		n := rng.Intn(PLEN)
 		copy(program[n+1:], program[n:])
 	}
 }
@@ -240,13 +241,22 @@ func runner(doneq chan int, runq chan [2]uint32, programs *[NPROGRAMS][PLEN]uint
 
 const SHOW = 1_000_000
 
+var rng *rand.Rand
+
 func main() {
+	seed := flag.Uint64("seed", 0, "random seed (0 picks one at random)")
+	flag.Parse()
+	for *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	rng = rand.New(*seed)
 	f := fmt.Sprintf("log.%s", time.Now().Format("2006-01-02-15:04:05"))
 	log, err := os.Create(f)
 	if err != nil {
 		panic(err)
 	}
 	defer log.Close()
+	fmt.Fprintf(log, "seed,%d\n", *seed)
 
 	runq := make(chan [2]uint32, NPROGRAMS/2)
 	doneq := make(chan int, NPROGRAMS/2)
@@ -254,7 +264,7 @@ func main() {
 	var programs [NPROGRAMS][PLEN]uint8
 	for i := 0; i < NPROGRAMS; i++ {
 		for j := 0; j < PLEN; j++ {
-			programs[i][j] = uint8(rand.Intn(256))
+			programs[i][j] = uint8(rng.Intn(256))
 		}
 	}
 	showp(programs)
@@ -274,13 +284,13 @@ func main() {
 		n += NPROGRAMS / 2
 
 		if m > MUTATION_RATE {
-			mutate(&programs[rand.Intn(NPROGRAMS)], &programs)
+			mutate(&programs[rng.Intn(NPROGRAMS)], &programs)
 			m -= MUTATION_RATE
 		}
 
-		//p := rand.Perm(NPROGRAMS)
+		//p := rng.Perm(NPROGRAMS)
 		for i := 0; i < NPROGRAMS; i += 2 {
-			runq <- [2]uint32{rand.Uint32n(NPROGRAMS), rand.Uint32n((NPROGRAMS))}
+			runq <- [2]uint32{rng.Uint32n(NPROGRAMS), rng.Uint32n((NPROGRAMS))}
 		}
 		/*
 			for i := 0; i < NPROGRAMS; i += 2 {
@@ -290,7 +300,7 @@ func main() {
 		if n >= SHOW {
 			var count [256]uint
 			fmt.Print("\033c")
-			fmt.Printf("%d\n", generation)
+			fmt.Printf("%d seed: %d\n", generation, *seed)
 			showp(programs)
 			fmt.Printf("Iterations: %d Time: %s\n", total_iterations, time.Since(start))
 			total_iterations = 0
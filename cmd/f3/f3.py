@@ -1,26 +1,17 @@
+import os
 import sys
 
-def read_long(s):
-    b = s.read(8)
-    assert len(b) == 8
-    return int.from_bytes(b, byteorder='little')
+sys.path.insert(0, os.path.join(os.path.dirname(os.path.abspath(__file__)), '..'))
+import souplog
 
-f = open(sys.argv[1], 'rb')
-
-ULEN = read_long(f)
-SLEN = read_long(f)
-ILIMIT = read_long(f)
-MUTATION_RATE = read_long(f)
-RUNNERS = read_long(f)
+log = souplog.Log(sys.argv[1], ops=False)
 
 def sign_extend(a):
 	if a&0x08 == 0x08:
 		return a - 0x10
 	return a
 
-while True:
-    generation = read_long(f)
-    program = f.read(ULEN)
+for generation, op_count, program in log.frames():
     print(generation)
     if generation < int(sys.argv[2]):
         continue
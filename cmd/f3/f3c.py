@@ -1,3 +1,4 @@
+import os
 import sys
 import zlib
 
@@ -5,33 +6,20 @@ import matplotlib.pyplot as plt
 import pandas
 import seaborn
 
-def read_long(s):
-    t = s.read(8)
-    if len(t) != 8:
-        raise EOFError()
-    return int.from_bytes(t, byteorder='little')
+sys.path.insert(0, os.path.join(os.path.dirname(os.path.abspath(__file__)), '..'))
+import souplog
 
 n = 0
 data = []
 d2 = []
 for fn in sys.argv[1:]:
-    f = open(fn, 'rb')
-    
-    ULEN = read_long(f)
-    SLEN = read_long(f)
-    ILIMIT = read_long(f)
-    MUTATION_RATE = read_long(f)
-    RUNNERS = read_long(f)
+    log = souplog.Log(fn, ops=False)
+    MUTATION_RATE = log.params['mutation_rate']
 
     label = f'{n} {MUTATION_RATE}'
 
     settled = False
-    while True:
-        try:
-            generation = read_long(f)
-        except EOFError:
-            break
-        program = f.read(ULEN)
+    for generation, op_count, program in log.frames():
 
         pc = zlib.compress(program, level=9)
 
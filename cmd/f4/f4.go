@@ -6,6 +6,11 @@ synth .... take ambient energy and make food (photosynthesis) - uses raw materia
 eat ..... take food and make energy
 direct ... use energy directly
 
+Every op a run executes costs a unit of its energy. The ambient energy is a
+budget shared by the whole universe: a unit is added every AMBIENT_EVERY
+runs, up to MAX_AMBIENT, and each food synthesised takes SYNTH_COST from it,
+so food can't be made faster than the ambient energy comes in.
+
 values:
 
 Food	an item of food, nop if exectued
@@ -14,8 +19,8 @@ Synth   make food at <1> -> <>
 Push xxxx
 Shift xxxx
 Copy    allow copying of food?
-Call
-Return
+Call    jump, pushing the return address on the call stack
+Return  jump back to the address popped off the call stack
 Inc
 Dec
 JNZ
@@ -26,11 +31,11 @@ JNZ
 0010 0001	Inc <top>
 0010 0010	Dec <top>
 0010 0011	Jump to <pc> + <top - 1> if <top> != 0, pop 2
-0010 0100	Jump to <pc> + <top>, pop 1, push <old pc> (call)
-0010 0101	Jump to <top>, pop 1 (return)
+0010 0100	Jump to <pc> + <top>, pop 1, push <pc> on the call stack (call)
+0010 0101	Jump to the address popped off the call stack (return)
 0010 0110	Food
 0010 0111	Eat <pc> + <top>, pop 1
-0010 1000	Synth <pc> + <top>, pop 1
+0010 1000	Synth <pc> + <top> for SYNTH_COST ambient energy, pop 1
 
 */
 
@@ -40,15 +45,20 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/rand"
-	"os"
-	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"links.org/bf/soup"
 )
 
 const ULEN = 8192 * 8
 const SLEN = 16
 const INITIAL_ENERGY = 100
 const FOOD_VAL = 10
+const SYNTH_COST = FOOD_VAL
+const AMBIENT_EVERY = 64
+const MAX_AMBIENT = 10_000
 const ILIMIT = 1000
 const MUTATION_RATE = 80_000 * 32 / ULEN
 const RUNNERS = 8
@@ -75,6 +85,13 @@ const (
 
 var pcs [RUNNERS]int
 
+var ambient atomic.Int64
+
+// Totals over all runs
+var synthesised atomic.Uint64
+var eaten atomic.Uint64
+var spent atomic.Uint64
+
 func pmod(a int, b int) int {
 	return (a%b + b) % b
 }
@@ -86,11 +103,37 @@ func sign_extend(a uint8) int8 {
 	return int8(a)
 }
 
-func run(program *[ULEN]uint8, pc int, id int) {
+// take takes n units of the ambient energy, if there are that many.
+func take(n int64) bool {
+	for {
+		a := ambient.Load()
+		if a < n {
+			return false
+		}
+		if ambient.CompareAndSwap(a, a-n) {
+			return true
+		}
+	}
+}
+
+// give adds a unit of ambient energy, up to MAX_AMBIENT.
+func give() {
+	for {
+		a := ambient.Load()
+		if a >= MAX_AMBIENT || ambient.CompareAndSwap(a, a+1) {
+			return
+		}
+	}
+}
+
+func run(program *[ULEN]uint8, pc int, id int) int {
 	var stack [SLEN]int8
 	sp := 0
+	var calls [SLEN]int
+	cp := 0
 	energy := INITIAL_ENERGY
 	iterations := 0
+	n_spent, n_synth, n_eaten := 0, 0, 0
 OUTER:
 	for {
 		if energy--; energy < 0 {
@@ -99,6 +142,7 @@ OUTER:
 		if iterations++; iterations > ILIMIT {
 			break
 		}
+		n_spent++
 		pcs[id] = pc
 		op := program[pc]
 		pc = (pc + 1) % ULEN
@@ -150,9 +194,21 @@ OUTER:
 					break OUTER
 				}
 			case CALL:
-				// FIXME
+				if sp > 0 && cp < SLEN {
+					calls[cp] = pc
+					cp++
+					pc = pmod(pc+int(stack[sp-1]), ULEN)
+					sp--
+				} else if STRICT {
+					break OUTER
+				}
 			case RETURN:
-				// FIXME
+				if cp > 0 {
+					cp--
+					pc = calls[cp]
+				} else if STRICT {
+					break OUTER
+				}
 			case FOOD:
 				// Do nothing
 			case EAT:
@@ -161,12 +217,16 @@ OUTER:
 					if program[loc] == FOOD {
 						program[loc] = NOP
 						energy += FOOD_VAL
+						n_eaten++
 					}
 				}
 			case SYNTH:
 				if sp > 0 {
 					loc := pmod(pc+int(stack[sp-1]), ULEN)
-					program[loc] = FOOD
+					if program[loc] != FOOD && take(SYNTH_COST) {
+						program[loc] = FOOD
+						n_synth++
+					}
 				}
 			case POP:
 				if sp > 0 {
@@ -175,6 +235,10 @@ OUTER:
 			}
 		}
 	}
+	spent.Add(uint64(n_spent))
+	synthesised.Add(uint64(n_synth))
+	eaten.Add(uint64(n_eaten))
+	return iterations
 }
 
 func charp(op uint8) string {
@@ -224,40 +288,31 @@ func showp(program *[ULEN]uint8) {
 	}
 }
 
-func ngrams(universe *[ULEN]uint8, n int) map[string]int {
-	m := make(map[string]int)
-	for i := 0; i < ULEN-n; i++ {
-		gram := ""
-		for j := 0; j < n; j++ {
-			gram += charp(universe[i+j])
+const DENSITY = " .:-=+*#%@"
+
+// showFood prints a line of the food density, each character covering
+// ULEN/128 cells, and returns the number of food cells.
+func showFood(program *[ULEN]uint8) int {
+	const CELLS = ULEN / 128
+	total := 0
+	var line strings.Builder
+	for i := 0; i < ULEN; i += CELLS {
+		n := 0
+		for _, op := range program[i : i+CELLS] {
+			if op == FOOD {
+				n++
+			}
 		}
-		m[gram]++
+		// Any food at all shows
+		line.WriteByte(DENSITY[(n*(len(DENSITY)-1)+CELLS-1)/CELLS])
+		total += n
 	}
-	return m
+	fmt.Println(line.String())
+	return total
 }
 
-func showngrams(universe *[ULEN]uint8, n int) {
-	m := ngrams(universe, n)
-	keys := make([]string, 0, len(m))
-
-	for key := range m {
-		keys = append(keys, key)
-	}
-
-	sort.SliceStable(keys, func(i, j int) bool {
-		return m[keys[i]] < m[keys[j]]
-	})
-
-	top := m[keys[len(keys)-1]]
-	l := 0
-	for n := len(keys) - 1; n >= 0 && l < 8; n-- {
-		l++
-		key := keys[n]
-		if m[key] <= top/10 {
-			break
-		}
-		fmt.Printf("% 15s% 5d ", key, m[key])
-	}
+func u64(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
 }
 
 func mutate(program *[ULEN]uint8) {
@@ -271,23 +326,19 @@ func mutate(program *[ULEN]uint8) {
 	}
 }
 
-func runner(universe *[ULEN]uint8, generation *uint64, id int) {
+func runner(universe *[ULEN]uint8, generation *atomic.Uint64, n_ops *atomic.Uint64, id int) {
 	n := 0
 	for {
 		n++
 
-		run(universe, rand.Intn(ULEN), id)
+		n_ops.Add(uint64(run(universe, rand.Intn(ULEN), id)))
+		if n%AMBIENT_EVERY == 0 {
+			give()
+		}
 		if rand.Intn(MUTATION_RATE) == 0 {
 			mutate(universe)
 		}
-		*generation++
-	}
-}
-
-func dump(f *os.File, generation uint64, universe *[ULEN]uint8) {
-	binary.Write(f, binary.LittleEndian, uint64(generation))
-	for i := 0; i < ULEN; i++ {
-		binary.Write(f, binary.LittleEndian, universe[i])
+		generation.Add(1)
 	}
 }
 
@@ -297,37 +348,62 @@ func main() {
 		strict = "strict"
 	}
 	f := fmt.Sprintf("f4.log.%s.%s", strict, time.Now().Format("2006-01-02-15:04:05"))
-	log, err := os.Create(f)
+	cfg := soup.Config{
+		ULen:         ULEN,
+		SLen:         SLEN,
+		ILimit:       ILIMIT,
+		MutationRate: MUTATION_RATE,
+		Runners:      RUNNERS,
+		Strict:       STRICT,
+		ShowLen:      SHOW_LEN,
+	}
+	economy := struct {
+		InitialEnergy int `json:"initial_energy"`
+		FoodVal       int `json:"food_val"`
+		SynthCost     int `json:"synth_cost"`
+		AmbientEvery  int `json:"ambient_every"`
+		MaxAmbient    int `json:"max_ambient"`
+	}{INITIAL_ENERGY, FOOD_VAL, SYNTH_COST, AMBIENT_EVERY, MAX_AMBIENT}
+	// The totals after each frame's universe
+	fields := []soup.Field{
+		{Name: "food", Type: soup.U64},
+		{Name: "ambient", Type: soup.U64},
+		{Name: "synthesised", Type: soup.U64},
+		{Name: "eaten", Type: soup.U64},
+		{Name: "energy_spent", Type: soup.U64},
+	}
+	log, err := soup.NewFieldLogger(f, "f4", &cfg, fields, &economy)
 	if err != nil {
 		panic(err)
 	}
 	defer log.Close()
 
-	binary.Write(log, binary.LittleEndian, uint64(ULEN))
-	binary.Write(log, binary.LittleEndian, uint64(SLEN))
-	binary.Write(log, binary.LittleEndian, uint64(INITIAL_ENERGY))
-	binary.Write(log, binary.LittleEndian, uint64(MUTATION_RATE))
-	binary.Write(log, binary.LittleEndian, uint64(RUNNERS))
-
 	var universe [ULEN]uint8
 
 	for i := 0; i < ULEN; i++ {
 		universe[i] = 0x3f
 	}
+	ambient.Store(MAX_AMBIENT)
 
-	var generation uint64
+	var generation atomic.Uint64
+	var n_ops atomic.Uint64
 	for i := 0; i < RUNNERS; i++ {
-		go runner(&universe, &generation, i)
+		go runner(&universe, &generation, &n_ops, i)
 	}
 
+	var kmers soup.KmerCounter
 	for {
 		var u2 [ULEN]uint8
 		copy(u2[:], universe[:])
-		dump(log, generation, &u2)
-		fmt.Println("\033c", generation)
+		g, n := generation.Load(), n_ops.Load()
+		a, s, e, sp := ambient.Load(), synthesised.Load(), eaten.Load(), spent.Load()
+		fmt.Println("\033c", g)
 		showp(&u2)
+		food := showFood(&u2)
+		fmt.Printf("%d food, %d ambient energy, %d synthesised, %d eaten, %d energy spent\n", food, a, s, e, sp)
+		log.DumpFields(g, n, u2[:], u64(uint64(food)), u64(uint64(a)), u64(s), u64(e), u64(sp))
 		for i := 2; i < 16; i++ {
-			showngrams(&u2, i)
+			kmers.Show(u2[:], charp, i, false)
 			fmt.Print("\n")
 		}
 		for i := 0; i < RUNNERS; i++ {
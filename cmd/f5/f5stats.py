@@ -5,22 +5,14 @@ import plotly.express as px
 import plotly.graph_objects as go
 import sys
 import math
+import os
 
 from plotly.subplots import make_subplots
 
-def read_long(s):
-    b = s.read(8)
-    if len(b) < 8:
-        return 0, False
-    return int.from_bytes(b, byteorder='little'), True
+sys.path.insert(0, os.path.join(os.path.dirname(os.path.abspath(__file__)), '..'))
+import souplog
 
-f = open(sys.argv[1], 'rb')
-
-ULEN, _ = read_long(f)
-SLEN, _ = read_long(f)
-ILIMIT, _ = read_long(f)
-MUTATION_RATE, _ = read_long(f)
-RUNNERS, _ = read_long(f)
+log = souplog.Log(sys.argv[1])
 
 #print(f'ULEN: {ULEN} SLEN: {SLEN} ILIMIT: {ILIMIT} MUTATION_RATE: {MUTATION_RATE} RUNNERS: {RUNNERS}')
 
@@ -54,14 +46,9 @@ y4 = []
 y5 = []
 prev_program = None
 print("generation, op_count, delta_gen, rate, cratio, entropy, entropy-cratio, changes")
-while True:
-    generation, ok = read_long(f)
-    if not ok:
-        break
-    op_count, _ = read_long(f)
-    program = f.read(ULEN)
+for generation, op_count, program in log.frames():
     
-    rate = (op_count-po) / (generation-pg)
+    rate = (op_count-po) / (generation-pg) if generation != pg else None
     compressaed = brotli.compress(program)
     cratio = len(compressaed) / len(program) * 8
     e = entropy(program)
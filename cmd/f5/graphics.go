@@ -6,37 +6,53 @@ package main
 import (
 	"image"
 	"image/color"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"github.com/crazy3lf/colorconv"
+	"links.org/bf/isa/f5"
+	"links.org/bf/soup"
 )
 
-func graphics(universe *[65536]uint8) {
+func graphics(s *soup.Soup) {
+	ulen := len(s.Universe)
+	sqrt_ulen := int(math.Sqrt(float64(ulen)))
+
+	// The rasters draw from the latest snapshot, never the live universe
+	var snapshot atomic.Pointer[soup.Universe]
+	snap := func() {
+		u := make(soup.Universe, ulen)
+		s.Snapshot(u)
+		snapshot.Store(&u)
+	}
+	snap()
+
 	myApp := app.New()
 	w := myApp.NewWindow("Raster")
 
 	raster := canvas.NewRasterWithPixels(
 		func(x, y, w, h int) color.Color {
 
-			x = x * SQRT_ULEN / w
-			y = y * SQRT_ULEN / h
-			n := x + y*SQRT_ULEN
-			if n >= ULEN {
+			x = x * sqrt_ulen / w
+			y = y * sqrt_ulen / h
+			n := x + y*sqrt_ulen
+			if n >= ulen {
 				hsl, _ := colorconv.HSLToColor(0.0, 0.0, 0.0)
 				return hsl
 			}
 
-			op := universe[n]
+			op := (*snapshot.Load())[n]
 
-			if op > MAX_OP {
+			if op > f5.MAX_OP {
 				hsl, _ := colorconv.HSLToColor(0.0, 0.0, 0.0)
 				return hsl
 			}
 
-			hsl, err := colorconv.HSLToColor(float64(op)/float64(MAX_OP+1)*360.0, 0.9, 0.5)
+			hsl, err := colorconv.HSLToColor(float64(op)/float64(f5.MAX_OP+1)*360.0, 0.9, 0.5)
 
 			if err != nil {
 				panic(err)
@@ -47,17 +63,30 @@ func graphics(universe *[65536]uint8) {
 		})
 
 	w.SetContent(raster)
-	w.Resize(fyne.NewSize(SQRT_ULEN*2, SQRT_ULEN*2))
+	w.Resize(fyne.NewSize(float32(sqrt_ulen*2), float32(sqrt_ulen*2)))
 
+	// With -profile there are two more columns, like cpu1's: how often each
+	// op was executed and how often it halted a run, over the last second
+	var profile atomic.Pointer[soup.Profile]
 	i_w := myApp.NewWindow("Instructions")
 	i_raster := canvas.NewRaster(
 		func(w, h int) image.Image {
-			var ops [256]uint64
-			max := uint64(0)
-			for i := 0; i < ULEN; i++ {
-				ops[universe[i]]++
-				if ops[universe[i]] > max {
-					max = ops[universe[i]]
+			universe := *snapshot.Load()
+			var cols [3][256]uint64
+			for i := 0; i < ulen; i++ {
+				cols[0][universe[i]]++
+			}
+			n := 1
+			if p := profile.Load(); p != nil {
+				cols[1], cols[2] = p.Ops, p.Errors
+				n = 3
+			}
+			var max [3]uint64
+			for c := range cols {
+				for _, v := range cols[c] {
+					if v > max[c] {
+						max[c] = v
+					}
 				}
 			}
 			image := image.NewRGBA(image.Rect(0, 0, w, h))
@@ -66,21 +95,28 @@ func graphics(universe *[65536]uint8) {
 				if op > 255 {
 					op = 255
 				}
-				hue := float64(op) / float64(MAX_OP+1) * 360.0
-				l := float64(ops[op]) / float64(max)
+				hue := float64(op) / float64(f5.MAX_OP+1) * 360.0
 				s := 1.0
-				if op > MAX_OP {
+				if op > f5.MAX_OP {
 					hue = 0.0
 					s = 0.0
 				}
 
-				hsl, err := colorconv.HSLToColor(hue, s, l)
-				if err != nil {
-					panic(err)
+				var row [3]color.Color
+				for c := 0; c < n; c++ {
+					l := 0.0
+					if max[c] != 0 {
+						l = float64(cols[c][op]) / float64(max[c])
+					}
+					hsl, err := colorconv.HSLToColor(hue, s, l)
+					if err != nil {
+						panic(err)
+					}
+					row[c] = hsl
 				}
 
 				for x := 0; x < w; x++ {
-					image.Set(x, y, hsl)
+					image.Set(x, y, row[x*n/w])
 				}
 			}
 			return image
@@ -89,13 +125,30 @@ func graphics(universe *[65536]uint8) {
 	i_w.Resize(fyne.NewSize(128, 512))
 
 	go func() {
+		var last *soup.Profile
+		next := time.Now()
 		for {
+			snap()
+			if p := s.Profile(); p != nil && time.Now().After(next) {
+				if last != nil {
+					profile.Store(p.Sub(last))
+				}
+				last, next = p, time.Now().Add(time.Second)
+			}
 			raster.Refresh()
 			i_raster.Refresh()
-			time.Sleep(20 * time.Millisecond)
+			select {
+			case <-s.Done():
+				myApp.Quit()
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
 		}
 	}()
 
 	i_w.Show()
 	w.ShowAndRun()
+	// Closing the window stops the run too
+	s.Stop("window closed")
+	<-s.Done()
 }
@@ -0,0 +1,116 @@
+//go:build graphics
+// +build graphics
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
+	"github.com/crazy3lf/colorconv"
+	"links.org/bf/soup"
+)
+
+func graphics(s *soup.Soup) {
+	// The raster draws from the latest snapshot, never the live universe
+	var snapshot atomic.Pointer[soup.Universe]
+	snap := func() {
+		u := make(soup.Universe, len(s.Universe))
+		s.Snapshot(u)
+		snapshot.Store(&u)
+	}
+	snap()
+
+	myApp := app.New()
+	w := myApp.NewWindow("Raster")
+
+	raster := canvas.NewRasterWithPixels(
+		func(x, y, w, h int) color.Color {
+			universe := *snapshot.Load()
+			n := x + y*w
+			if n >= len(universe) {
+				return color.Black
+			}
+
+			op := universe[n]
+
+			hsl, _ := colorconv.HSLToColor(float64(op)/256.0*360.0, 1.0, 0.5)
+
+			return hsl
+		})
+	w.SetContent(raster)
+	w.Resize(fyne.NewSize(128, float32(len(s.Universe)/128)))
+
+	// With -profile, how often each op was executed and how often it halted
+	// a run, over the last second, like cpu1's instruction window
+	var profile atomic.Pointer[soup.Profile]
+	p_w := myApp.NewWindow("Profile")
+	p_raster := canvas.NewRaster(
+		func(w, h int) image.Image {
+			image := image.NewRGBA(image.Rect(0, 0, w, h))
+			p := profile.Load()
+			if p == nil {
+				return image
+			}
+			cols := [2][256]uint64{p.Ops, p.Errors}
+			var max [2]uint64
+			for c := range cols {
+				for _, v := range cols[c] {
+					if v > max[c] {
+						max[c] = v
+					}
+				}
+			}
+			for y := 0; y < h; y++ {
+				op := min(y*256/h, 255)
+				var row [2]color.Color
+				for c := range row {
+					l := 0.0
+					if max[c] != 0 {
+						l = float64(cols[c][op]) / float64(max[c])
+					}
+					row[c], _ = colorconv.HSLToColor(float64(op)/256.0*360.0, 1.0, l)
+				}
+				for x := 0; x < w; x++ {
+					image.Set(x, y, row[x*2/w])
+				}
+			}
+			return image
+		})
+	p_w.SetContent(p_raster)
+	p_w.Resize(fyne.NewSize(128, 512))
+
+	go func() {
+		var last *soup.Profile
+		for {
+			snap()
+			raster.Refresh()
+			if p := s.Profile(); p != nil {
+				if last != nil {
+					profile.Store(p.Sub(last))
+					p_raster.Refresh()
+				}
+				last = p
+			}
+			select {
+			case <-s.Done():
+				myApp.Quit()
+				return
+			case <-time.After(1 * time.Second):
+			}
+		}
+	}()
+
+	if s.Profile() != nil {
+		p_w.Show()
+	}
+	w.ShowAndRun()
+	// Closing the window stops the run too
+	s.Stop("window closed")
+	<-s.Done()
+}
@@ -0,0 +1,10 @@
+//go:build !graphics
+// +build !graphics
+
+package main
+
+import "links.org/bf/soup"
+
+func graphics(s *soup.Soup) {
+	<-s.Done()
+}
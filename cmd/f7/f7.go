@@ -0,0 +1,121 @@
+/*
+f7 is f6 run on juice, see package f7. Each cell's juice is used up by
+running the op in it and comes back a unit every REGEN_EVERY runs, so runs
+that loop on the same cells starve.
+
+The juice belongs to the ISA, which the soup logs after the universe in each
+frame, as a "juice" field, and keeps in its checkpoints. Runs must take
+turns on the one universe and its juice, so f7 runs the round-robin schedule
+by default and refuses the parallel and serial ones. The terminal shows how
+much juice is left below the soup, and f7 profiles by default so halts show
+too. The universe is always ULEN cells, the size the graphics are drawn for.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"links.org/bf/asm"
+	"links.org/bf/isa/f7"
+	"links.org/bf/soup"
+)
+
+const ULEN = 256 * 256
+const SQRT_ULEN = 256
+
+const MAX_OP = f7.MAX_OP
+
+var cfg = soup.Config{
+	ULen:         ULEN,
+	SLen:         1024,
+	ILimit:       1_000,
+	MutationRate: 80_000 * 32 / ULEN,
+	Runners:      1,
+	Strict:       true,
+	ShowLen:      8192,
+	Schedule:     soup.ROUND_ROBIN,
+	Profile:      true,
+}
+
+// frame is a snapshot of the universe and its juice, which the display is
+// made from rather than the live ones.
+type frame struct {
+	universe [ULEN]uint8
+	juice    [ULEN]uint8
+}
+
+// snapshot copies the soup's universe and juice into a new frame.
+func snapshot(s *soup.Soup) *frame {
+	fr := &frame{}
+	_, _, values := s.SnapshotFields(fr.universe[:])
+	copy(fr.juice[:], values[0])
+	return fr
+}
+
+// level is cell n's juice in hundreds of units, which graphics.go shows as
+// a grey from half way to white for a full cell.
+func (fr *frame) level(n int) float64 {
+	return float64(fr.juice[n]) / 100
+}
+
+// monitor is Soup.Monitor, also showing how much juice is left.
+func monitor(s *soup.Soup) {
+	for {
+		s.Status()
+		if !cfg.Quiet {
+			fr := snapshot(s)
+			total, empty := 0, 0
+			for _, j := range fr.juice {
+				total += int(j)
+				if j == 0 {
+					empty++
+				}
+			}
+			fmt.Printf("juice: mean %.1f of %d, %d cells empty\n", float64(total)/ULEN, f7.MAX_JUICE, empty)
+		}
+		select {
+		case <-s.Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+func main() {
+	cfg.RegisterFlags(flag.CommandLine)
+	if err := soup.ParseFlags(flag.CommandLine, os.Args[1:], &cfg); err != nil {
+		panic(err)
+	}
+	switch {
+	case cfg.ULen != ULEN:
+		panic(fmt.Sprintf("f7's universe is %d cells, not %d", ULEN, cfg.ULen))
+	case cfg.Schedule != soup.ROUND_ROBIN && cfg.Schedule != soup.RANDOM:
+		panic(fmt.Sprintf("f7's runs share the juice, so can't run the %s schedule", cfg.Schedule))
+	}
+
+	isa := f7.New(&cfg)
+	params := struct {
+		MaxJuice   int `json:"max_juice"`
+		RegenEvery int `json:"regen_every"`
+	}{f7.MAX_JUICE, f7.REGEN_EVERY}
+	f := fmt.Sprintf("logs/f7.log.%s.%s", cfg.StrictName(), time.Now().Format("2006-01-02-15:04:05"))
+	log, err := soup.NewFieldLogger(f, "f7", &cfg, isa.Fields(), &params)
+	if err != nil {
+		panic(err)
+	}
+	defer log.Close()
+
+	s := soup.NewSoup(isa, &cfg)
+	s.Log = log
+	s.Assemble = asm.MustLookup("f6").Assemble
+	s.Universe.Fill(0x3f)
+	s.Kmers = true
+
+	s.Start()
+	go monitor(s)
+
+	graphics(s)
+}
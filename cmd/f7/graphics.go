@@ -6,20 +6,30 @@ package main
 import (
 	"image"
 	"image/color"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"github.com/crazy3lf/colorconv"
+	"links.org/bf/soup"
 )
 
-func graphics(universe *[65536]uint8) {
+func graphics(s *soup.Soup) {
+	// The rasters draw from the latest snapshot, never the live universe
+	var shown atomic.Pointer[frame]
+	snap := func() {
+		shown.Store(snapshot(s))
+	}
+	snap()
+
 	myApp := app.New()
 	w := myApp.NewWindow("Raster")
 
 	raster := canvas.NewRasterWithPixels(
 		func(x, y, w, h int) color.Color {
+			fr := shown.Load()
 
 			x = x * SQRT_ULEN / w
 			y = y * SQRT_ULEN / h
@@ -29,10 +39,10 @@ func graphics(universe *[65536]uint8) {
 				return hsl
 			}
 
-			op := universe[n]
+			op := fr.universe[n]
 
 			if op > MAX_OP {
-				l := juice(n)/(512/100.) + .5
+				l := fr.level(n)/(512/100.) + .5
 				hsl, _ := colorconv.HSLToColor(0.0, 0.0, l)
 				return hsl
 			}
@@ -55,6 +65,7 @@ func graphics(universe *[65536]uint8) {
 	i_w := myApp.NewWindow("Instructions")
 	i_raster := canvas.NewRaster(
 		func(w, h int) image.Image {
+			universe := &shown.Load().universe
 			var ops [256]uint64
 			max := uint64(0)
 			for i := 0; i < ULEN; i++ {
@@ -93,12 +104,21 @@ func graphics(universe *[65536]uint8) {
 
 	go func() {
 		for {
+			snap()
 			raster.Refresh()
 			i_raster.Refresh()
-			time.Sleep(20 * time.Millisecond)
+			select {
+			case <-s.Done():
+				myApp.Quit()
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
 		}
 	}()
 
 	i_w.Show()
 	w.ShowAndRun()
+	// Closing the window stops the run too
+	s.Stop("window closed")
+	<-s.Done()
 }
@@ -0,0 +1,135 @@
+/*
+soupasm assembles and disassembles programs for the stack soups, f3, f5 and
+f6. See package asm for the source syntax.
+
+	soupasm asm [-isa NAME] [-hex] [-o OUT] SRC
+	soupasm dis [-isa NAME] [-generation N] [-off N] [-n N] LOG
+	soupasm dis -raw [-isa NAME] [-off N] [-n N] FILE
+
+asm writes the program's bytes to OUT, or stdout, or with -hex writes them
+as hex. dis disassembles cells from the first frame at or after a
+generation of a log, or from a file of bytes with -raw, as source that asm
+turns back into the same bytes.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"links.org/bf/asm"
+	"links.org/bf/soup"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: soupasm asm|dis [flags] FILE")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "asm":
+		err = assemble(os.Args[2:])
+	case "dis":
+		err = disassemble(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "soupasm:", err)
+		os.Exit(1)
+	}
+}
+
+func isaFlag(fs *flag.FlagSet) *string {
+	return fs.String("isa", "", "ISA: "+strings.Join(asm.Names(), ", ")+" (default f5, or what the log says)")
+}
+
+func assemble(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	name := isaFlag(fs)
+	as_hex := fs.Bool("hex", false, "write hex rather than bytes")
+	out := fs.String("o", "", "write here rather than to stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	if *name == "" {
+		*name = "f5"
+	}
+	d, err := asm.Lookup(*name)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	b, err := d.Assemble(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	if *as_hex {
+		b = []byte(hex.EncodeToString(b) + "\n")
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0666)
+}
+
+func disassemble(args []string) error {
+	fs := flag.NewFlagSet("dis", flag.ExitOnError)
+	name := isaFlag(fs)
+	raw := fs.Bool("raw", false, "FILE is bytes, not a log")
+	generation := fs.Uint64("generation", 0, "disassemble the first frame at or after this generation")
+	off := fs.Int("off", 0, "first cell")
+	n := fs.Int("n", 0, "number of cells, 0 for all")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	var u []uint8
+	if *raw {
+		b, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		u = b
+	} else {
+		h, fr, err := soup.ReadFrame(fs.Arg(0), *generation)
+		if err != nil {
+			return err
+		}
+		if *name == "" {
+			*name = h.ISA
+		}
+		fmt.Printf("; generation %d, ops %d\n", fr.Generation, fr.NOps)
+		u = fr.Universe
+	}
+	if *name == "" {
+		*name = "f5"
+	}
+	d, err := asm.Lookup(*name)
+	if err != nil {
+		return err
+	}
+	if len(u) == 0 {
+		return errors.New("nothing to disassemble")
+	}
+	if *n == 0 {
+		*n = len(u)
+	}
+	return d.Disassemble(os.Stdout, u, soup.Pmod(*off, len(u)), *n)
+}
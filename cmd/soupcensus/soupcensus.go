@@ -0,0 +1,348 @@
+/*
+soupcensus finds the replicators in a soup log: the sequences repeated most
+often in each frame, found with a suffix array over the circular universe.
+
+	soupcensus top [flags] LOG
+	soupcensus track [flags] LOG
+	soupcensus isolate [-generation N] -at POS -len N [flags] LOG
+	soupcensus isolate -hex SEQ [flags] [LOG]
+
+top lists the most common repeats in each frame with their counts and
+positions. track picks the repeats that were most common at any point in
+the log and writes their counts in every frame as CSV, so you can see which
+replicator wins and when; a legend saying when each first led goes to
+stderr.
+
+Both take -from and -to to pick generations, -every to only look at a frame
+every so many generations, -min-len and -max-len to bound the length of
+the repeats, and -n for how many to list or track.
+
+isolate tests whether a sequence, from a frame or given in hex as track
+writes it, replicates on its own: it puts it in an otherwise inert
+universe and runs it, first from its start and then from random pcs within
+it, with the ISA and limits the log was made with. A sequence given in hex
+needs no log, only -isa; -slen, -ilimit and -strict set the limits, or
+override the log's. It reports the copies made, how faithful the attempts
+at copies were, when the first exact copy appeared and how many of the
+attempts copy themselves in turn.
+*/
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"links.org/bf/isa"
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: soupcensus top|track|isolate [flags] LOG")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "top":
+		err = top(os.Args[2:])
+	case "track":
+		err = track(os.Args[2:])
+	case "isolate":
+		err = isolate(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "soupcensus:", err)
+		os.Exit(1)
+	}
+}
+
+type census struct {
+	fs      *flag.FlagSet
+	from    *uint64
+	to      *uint64
+	every   *uint64
+	min_len *int
+	max_len *int
+	n       *int
+	isa     *string
+
+	l      *soup.LogReader
+	f      *os.File
+	glyphs soup.ISA // May be nil
+}
+
+func newCensus(name string, n int) *census {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &census{
+		fs:      fs,
+		from:    fs.Uint64("from", 0, "first generation"),
+		to:      fs.Uint64("to", math.MaxUint64, "last generation"),
+		every:   fs.Uint64("every", 0, "only look at a frame every this many generations"),
+		min_len: fs.Int("min-len", 16, "shortest repeat"),
+		max_len: fs.Int("max-len", 256, "cut longer repeats to this"),
+		n:       fs.Int("n", n, "number of repeats"),
+		isa:     fs.String("isa", "", "ISA to render with, if the log doesn't say: "+strings.Join(isa.Names(), ", ")),
+	}
+}
+
+func (c *census) open(args []string) error {
+	c.fs.Parse(args)
+	if c.fs.NArg() != 1 {
+		usage()
+	}
+	var err error
+	c.l, c.f, err = soup.OpenLog(c.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	name := *c.isa
+	if name == "" {
+		name = c.l.Header.ISA
+	}
+	if name != "" {
+		conf, err := c.l.Header.Config()
+		if err != nil {
+			return err
+		}
+		if c.glyphs, err = isa.New(name, conf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// frames calls fn with every frame from -from to -to, skipping any less
+// than -every generations after the last.
+func (c *census) frames(fn func(fr *soup.Frame) error) error {
+	if err := c.l.SeekGeneration(*c.from); err != nil {
+		return err
+	}
+	next := uint64(0)
+	for {
+		fr, err := c.l.Next()
+		if err == io.EOF || (err == nil && fr.Generation > *c.to) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fr.Generation < next {
+			continue
+		}
+		next = fr.Generation + *c.every
+		if err := fn(fr); err != nil {
+			return err
+		}
+	}
+}
+
+// render shows seq with the ISA's glyphs, or in hex.
+func (c *census) render(seq []uint8) string {
+	if c.glyphs == nil {
+		return hex.EncodeToString(seq)
+	}
+	var b strings.Builder
+	for _, op := range seq {
+		b.WriteString(c.glyphs.Glyph(op))
+	}
+	return b.String()
+}
+
+func top(args []string) error {
+	c := newCensus("top", 10)
+	positions := c.fs.Int("positions", 8, "number of positions to list")
+	if err := c.open(args); err != nil {
+		return err
+	}
+	defer c.f.Close()
+
+	return c.frames(func(fr *soup.Frame) error {
+		fmt.Println("generation:", fr.Generation, "ops:", fr.NOps)
+		for _, r := range fr.Universe.Census(*c.min_len, *c.max_len, *c.n) {
+			pos := r.Positions
+			if len(pos) > *positions {
+				pos = pos[:*positions]
+			}
+			fmt.Printf("%6d x %-4d %v %s\n", r.Count, len(r.Seq), pos, c.render(r.Seq))
+		}
+		fmt.Println()
+		return nil
+	})
+}
+
+// candidate is a repeat that made a frame's census.
+type candidate struct {
+	soup.Repeat        // Count is the most seen in one frame
+	first       uint64 // Generation it was first seen
+	led         uint64 // Generation it first led the census
+	has_led     bool
+}
+
+func track(args []string) error {
+	c := newCensus("track", 5)
+	out := c.fs.String("o", "", "write the CSV here rather than to stdout")
+	if err := c.open(args); err != nil {
+		return err
+	}
+	defer c.f.Close()
+
+	// First find the repeats that matter
+	candidates := make(map[string]*candidate)
+	err := c.frames(func(fr *soup.Frame) error {
+		for i, r := range fr.Universe.Census(*c.min_len, *c.max_len, *c.n) {
+			k := string(r.Seq)
+			cd := candidates[k]
+			if cd == nil {
+				cd = &candidate{Repeat: r, first: fr.Generation}
+				candidates[k] = cd
+			}
+			cd.Count = max(cd.Count, r.Count)
+			if i == 0 && !cd.has_led {
+				cd.led, cd.has_led = fr.Generation, true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var repeats []soup.Repeat
+	for _, cd := range candidates {
+		repeats = append(repeats, cd.Repeat)
+	}
+	sort.Slice(repeats, func(i, j int) bool {
+		a, b := repeats[i].Cover(), repeats[j].Cover()
+		if a != b {
+			return a > b
+		}
+		return string(repeats[i].Seq) < string(repeats[j].Seq)
+	})
+	repeats = soup.Distinct(repeats, *c.n)
+
+	header := []string{"generation"}
+	for i, r := range repeats {
+		cd := candidates[string(r.Seq)]
+		header = append(header, hex.EncodeToString(r.Seq))
+		led := "never led"
+		if cd.has_led {
+			led = fmt.Sprintf("led from %d", cd.led)
+		}
+		fmt.Fprintf(os.Stderr, "%d: peak %d, first seen %d, %s: %s\n", i+1, cd.Count, cd.first, led, c.render(r.Seq))
+	}
+
+	// Then count them in every frame
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	err = c.frames(func(fr *soup.Frame) error {
+		sa := soup.NewSuffixArray(fr.Universe)
+		record := []string{strconv.FormatUint(fr.Generation, 10)}
+		for _, r := range repeats {
+			record = append(record, strconv.Itoa(sa.Count(r.Seq)))
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func isolate(args []string) error {
+	fs := flag.NewFlagSet("isolate", flag.ExitOnError)
+	name := fs.String("isa", "", "ISA, if the log doesn't say: "+strings.Join(isa.Names(), ", "))
+	generation := fs.Uint64("generation", 0, "take the sequence from the first frame at or after this generation")
+	at := fs.Int("at", 0, "where the sequence starts in the frame")
+	n := fs.Int("len", 0, "length of the sequence")
+	seq_hex := fs.String("hex", "", "the sequence in hex, rather than from a frame")
+	ulen := fs.Int("ulen", 4096, "universe length")
+	runs := fs.Int("runs", 100, "runs each way")
+	filler := fs.Int("filler", -1, "inert cell, by default 0 for bfsoup and 0x3f for the others")
+	seed := fs.Uint64("seed", 1, "seed for the random pcs")
+	conf := &soup.Config{SLen: 1024, ILimit: 1_000, Strict: true}
+	fs.IntVar(&conf.SLen, "slen", conf.SLen, "stack length, if not the log's")
+	fs.IntVar(&conf.ILimit, "ilimit", conf.ILimit, "iteration limit, if not the log's")
+	fs.BoolVar(&conf.Strict, "strict", conf.Strict, "halt programs that do something illegal, if not as the log says")
+	fs.Parse(args)
+	if fs.NArg() > 1 || fs.NArg() == 0 && *seq_hex == "" {
+		usage()
+	}
+
+	var seq []uint8
+	if *seq_hex != "" {
+		var err error
+		if seq, err = hex.DecodeString(*seq_hex); err != nil {
+			return err
+		}
+	} else if *n <= 0 {
+		return fmt.Errorf("give the sequence with -at and -len, or -hex")
+	}
+	if fs.NArg() == 1 {
+		h, fr, err := soup.ReadFrame(fs.Arg(0), *generation)
+		if err != nil {
+			return err
+		}
+		if *name == "" {
+			*name = h.ISA
+		}
+		if err := h.Limits(conf, fs); err != nil {
+			return err
+		}
+		if seq == nil {
+			for j := 0; j < *n; j++ {
+				seq = append(seq, fr.Universe[soup.Pmod(*at+j, len(fr.Universe))])
+			}
+		}
+	}
+	if *name == "" {
+		return fmt.Errorf("give the ISA with -isa")
+	}
+	i, err := isa.New(*name, conf)
+	if err != nil {
+		return err
+	}
+	if *filler < 0 {
+		*filler = 0x3f
+		if *name == "bfsoup" {
+			*filler = 0
+		}
+	}
+
+	c := &census{glyphs: i}
+	fmt.Printf("%s (%d cells, %s)\n", c.render(seq), len(seq), hex.EncodeToString(seq))
+	h := &soup.Harness{ISA: i, ULen: *ulen, Filler: uint8(*filler), Runs: *runs, Rand: rand.New(*seed)}
+	for _, random := range []bool{false, true} {
+		is, err := h.Isolate(seq, random)
+		if err != nil {
+			return err
+		}
+		from := "from its start"
+		if random {
+			from = "from random pcs"
+		}
+		fmt.Printf("%s: %s\n", from, is)
+	}
+	return nil
+}
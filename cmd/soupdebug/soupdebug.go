@@ -0,0 +1,469 @@
+/*
+soupdebug runs one program of a logged universe, or of a file of bytes,
+under a debugger. It works for the ISAs that can run a step at a time, f5,
+f6 and bfsoup, and steps exactly as their soups run, strict or not.
+
+	soupdebug [-isa NAME] [-generation N] [-pc N] LOG
+	soupdebug -raw -isa NAME [-pc N] FILE
+
+The stack length, iteration limit and strictness come from the log, or can
+be given with -slen, -ilimit and -strict. Commands are read from stdin, see
+help; an empty line repeats the last.
+*/
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"links.org/bf/asm"
+	"links.org/bf/isa"
+	"links.org/bf/soup"
+)
+
+const HELP = `step [N]           run N ops, 1 by default, printing each
+continue           run until a breakpoint, a write to a watched cell or a halt
+break ADDR         stop before the op at ADDR
+break op OP        stop before any OP, given as a code or a mnemonic
+watch ADDR [N]     stop after a write to any of the N cells from ADDR
+delete             remove every breakpoint and watch
+info               show the pc, stack, heads, breakpoints and watches
+x [ADDR [N]]       show N cells from ADDR, by default 16 from the pc
+set pc ADDR
+set stack V...     replace the stack, bottom first
+set heads A B
+set iterations N
+set mem ADDR V...  write cells from ADDR on
+run [PC]           start again at PC, or where it last started
+reload             put the universe back as it was loaded and start again
+quit
+Changing the pc, stack, heads or iterations lets a halted program carry on.
+`
+
+func main() {
+	fs := flag.NewFlagSet("soupdebug", flag.ExitOnError)
+	name := fs.String("isa", "", "ISA, if the log doesn't say: "+strings.Join(isa.Names(), ", "))
+	raw := fs.Bool("raw", false, "FILE is bytes, not a log")
+	generation := fs.Uint64("generation", 0, "debug in the first frame at or after this generation")
+	pc := fs.Int("pc", 0, "where the program starts")
+	c := &soup.Config{SLen: 1024, ILimit: 1_000, Strict: true}
+	fs.IntVar(&c.SLen, "slen", c.SLen, "stack length")
+	fs.IntVar(&c.ILimit, "ilimit", c.ILimit, "iteration limit")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "halt programs that do something illegal")
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: soupdebug [flags] LOG|FILE")
+		os.Exit(2)
+	}
+
+	d, err := load(fs, c, *name, *raw, *generation)
+	if err == nil {
+		err = d.start(*pc)
+	}
+	if err == nil {
+		err = d.repl(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "soupdebug:", err)
+		os.Exit(1)
+	}
+}
+
+// load reads the universe and sets up the ISA to debug it with.
+func load(fs *flag.FlagSet, c *soup.Config, name string, raw bool, generation uint64) (*debugger, error) {
+	var u soup.Universe
+	if raw {
+		b, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		u = b
+	} else {
+		h, fr, err := soup.ReadFrame(fs.Arg(0), generation)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = h.ISA
+		}
+		if err := h.Limits(c, fs); err != nil {
+			return nil, err
+		}
+		fmt.Printf("generation %d, ops %d\n", fr.Generation, fr.NOps)
+		u = fr.Universe
+	}
+	if name == "" {
+		return nil, errors.New("the log doesn't say which ISA it is, use -isa")
+	}
+	if len(u) == 0 {
+		return nil, errors.New("nothing to debug")
+	}
+	i, err := isa.New(name, c)
+	if err != nil {
+		return nil, err
+	}
+	return newDebugger(i, name, u, os.Stdout), nil
+}
+
+type debugger struct {
+	isa      soup.ISA
+	mnemonic func(op uint8) string
+	ops      map[string]uint8 // By mnemonic, for the stack ISAs
+	frame    soup.Universe    // As loaded
+	u        soup.Universe
+	pc       int // Where the run started
+	t        *soup.StepTracer
+	breaks   map[int]bool
+	opbreaks map[uint8]bool
+	watches  map[int]bool
+	out      io.Writer
+}
+
+func newDebugger(i soup.ISA, name string, u soup.Universe, out io.Writer) *debugger {
+	d := &debugger{
+		isa:      i,
+		mnemonic: i.Glyph,
+		frame:    u,
+		u:        append(soup.Universe{}, u...),
+		breaks:   make(map[int]bool),
+		opbreaks: make(map[uint8]bool),
+		watches:  make(map[int]bool),
+		out:      out,
+	}
+	if dialect, err := asm.Lookup(name); err == nil {
+		d.mnemonic, d.ops = dialect.Mnemonic, dialect.Ops
+	}
+	return d
+}
+
+// start starts a run at pc in the universe as it is.
+func (d *debugger) start(pc int) error {
+	d.pc = soup.Pmod(pc, len(d.u))
+	t, err := soup.NewStepTracer(d.isa, d.u, d.pc)
+	if err != nil {
+		return err
+	}
+	d.t = t
+	return nil
+}
+
+// repl runs the commands in in until quit or the end.
+func (d *debugger) repl(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	last := ""
+	for {
+		fmt.Fprint(d.out, "(soupdebug) ")
+		if !sc.Scan() {
+			fmt.Fprintln(d.out)
+			return sc.Err()
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "q" {
+			return nil
+		}
+		if err := d.command(args[0], args[1:]); err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
+
+func (d *debugger) command(cmd string, args []string) error {
+	switch cmd {
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return fmt.Errorf("bad count %q", args[0])
+			}
+		}
+		for i := 0; i < n; i++ {
+			if !d.step() {
+				break
+			}
+		}
+	case "continue", "c":
+		d.cont()
+	case "break", "b":
+		if len(args) == 2 && args[0] == "op" {
+			op, err := d.op(args[1])
+			if err != nil {
+				return err
+			}
+			d.opbreaks[op] = true
+			return nil
+		}
+		if len(args) != 1 {
+			return errors.New("break ADDR or break op OP")
+		}
+		addr, err := d.addr(args[0])
+		if err != nil {
+			return err
+		}
+		d.breaks[addr] = true
+	case "watch", "w":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("watch ADDR [N]")
+		}
+		addr, err := d.addr(args[0])
+		if err != nil {
+			return err
+		}
+		n := 1
+		if len(args) == 2 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("bad count %q", args[1])
+			}
+		}
+		for i := 0; i < n; i++ {
+			d.watches[(addr+i)%len(d.u)] = true
+		}
+	case "delete", "d":
+		clear(d.breaks)
+		clear(d.opbreaks)
+		clear(d.watches)
+	case "info", "i":
+		d.info()
+	case "x":
+		addr, n := d.t.State().PC, 16
+		var err error
+		if len(args) > 0 {
+			if addr, err = d.addr(args[0]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("bad count %q", args[1])
+			}
+		}
+		d.examine(addr, n)
+	case "set":
+		if len(args) < 1 {
+			return errors.New("set pc|stack|heads|iterations|mem ...")
+		}
+		return d.set(args[0], args[1:])
+	case "run", "r":
+		pc := d.pc
+		if len(args) > 0 {
+			var err error
+			if pc, err = d.addr(args[0]); err != nil {
+				return err
+			}
+		}
+		return d.start(pc)
+	case "reload":
+		copy(d.u, d.frame)
+		return d.start(d.pc)
+	case "help", "h", "?":
+		fmt.Fprint(d.out, HELP)
+	default:
+		return fmt.Errorf("no command %s, try help", cmd)
+	}
+	return nil
+}
+
+// step runs and prints a step, reporting whether the program carries on.
+func (d *debugger) step() bool {
+	if s := d.t.State(); s.Halted {
+		fmt.Fprintf(d.out, "halted: %s\n", s.Halt)
+		return false
+	}
+	ts, more := d.t.Next()
+	fmt.Fprintln(d.out, ts.Format(d.mnemonic))
+	return more
+}
+
+// cont runs until a breakpoint, a watched write or a halt, printing the
+// step it stops after.
+func (d *debugger) cont() {
+	for first := true; ; first = false {
+		s := d.t.State()
+		if s.Halted {
+			fmt.Fprintf(d.out, "halted: %s\n", s.Halt)
+			return
+		}
+		if !first && d.breaks[s.PC] {
+			fmt.Fprintf(d.out, "breakpoint at %d\n", s.PC)
+			return
+		}
+		if op := d.u[s.PC]; !first && d.opbreaks[op] {
+			fmt.Fprintf(d.out, "breakpoint on %s at %d\n", d.mnemonic(op), s.PC)
+			return
+		}
+		ts, more := d.t.Next()
+		for _, w := range ts.Writes {
+			if d.watches[w.Dst] {
+				fmt.Fprintln(d.out, ts.Format(d.mnemonic))
+				fmt.Fprintf(d.out, "wrote watched cell %d\n", w.Dst)
+				return
+			}
+		}
+		if !more {
+			fmt.Fprintln(d.out, ts.Format(d.mnemonic))
+			return
+		}
+	}
+}
+
+func (d *debugger) info() {
+	s := d.t.State()
+	fmt.Fprintf(d.out, "pc %d: %02x %s, started at %d\n", s.PC, d.u[s.PC], d.mnemonic(d.u[s.PC]), d.pc)
+	fmt.Fprintf(d.out, "iterations %d", s.Iterations)
+	if s.Halted {
+		fmt.Fprintf(d.out, ", halted: %s", s.Halt)
+	}
+	fmt.Fprintln(d.out)
+	if s.Stack != nil {
+		fmt.Fprintf(d.out, "stack %v\n", s.Stack)
+	}
+	if s.Heads != nil {
+		fmt.Fprintf(d.out, "heads %v\n", s.Heads)
+	}
+	fmt.Fprintf(d.out, "breakpoints %v", sorted(d.breaks))
+	var ops []string
+	for _, op := range sorted(d.opbreaks) {
+		ops = append(ops, d.mnemonic(op))
+	}
+	fmt.Fprintf(d.out, " on ops %v, watching %v\n", ops, sorted(d.watches))
+}
+
+// examine prints n cells from addr, marking the pc with =>, breakpoints
+// with b and watched cells with w.
+func (d *debugger) examine(addr int, n int) {
+	pc := d.t.State().PC
+	for i := 0; i < n; i++ {
+		a := (addr + i) % len(d.u)
+		mark := ""
+		if a == pc {
+			mark += "=>"
+		}
+		if d.breaks[a] || d.opbreaks[d.u[a]] {
+			mark += "b"
+		}
+		if d.watches[a] {
+			mark += "w"
+		}
+		fmt.Fprintf(d.out, "%4s %6d: %02x %s\n", mark, a, d.u[a], d.mnemonic(d.u[a]))
+	}
+}
+
+func (d *debugger) set(what string, args []string) error {
+	s := d.t.State()
+	if what == "mem" {
+		if len(args) < 2 {
+			return errors.New("set mem ADDR V...")
+		}
+		addr, err := d.addr(args[0])
+		if err != nil {
+			return err
+		}
+		for i, arg := range args[1:] {
+			v, err := value(arg)
+			if err != nil {
+				return err
+			}
+			d.u[(addr+i)%len(d.u)] = uint8(v)
+		}
+		return nil
+	}
+	switch what {
+	case "pc":
+		if len(args) != 1 {
+			return errors.New("set pc ADDR")
+		}
+		pc, err := d.addr(args[0])
+		if err != nil {
+			return err
+		}
+		s.PC = pc
+	case "stack":
+		s.Stack = []int8{}
+		for _, arg := range args {
+			v, err := value(arg)
+			if err != nil {
+				return err
+			}
+			s.Stack = append(s.Stack, v)
+		}
+	case "heads":
+		if len(args) != 2 {
+			return errors.New("set heads A B")
+		}
+		s.Heads = nil
+		for _, arg := range args {
+			h, err := d.addr(arg)
+			if err != nil {
+				return err
+			}
+			s.Heads = append(s.Heads, h)
+		}
+	case "iterations":
+		n, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad iterations %q", strings.Join(args, " "))
+		}
+		s.Iterations = n
+	default:
+		return fmt.Errorf("can't set %s", what)
+	}
+	s.Halted = false
+	return d.t.SetState(s)
+}
+
+// addr parses an address, wrapping it into the universe.
+func (d *debugger) addr(arg string) (int, error) {
+	a, err := strconv.ParseInt(arg, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %q", arg)
+	}
+	return soup.Pmod(int(a), len(d.u)), nil
+}
+
+// op parses an op, as a code, a mnemonic of a stack ISA or one of bfsoup's
+// characters.
+func (d *debugger) op(arg string) (uint8, error) {
+	if v, err := strconv.ParseUint(arg, 0, 8); err == nil {
+		return uint8(v), nil
+	}
+	if op, ok := d.ops[strings.ToUpper(arg)]; ok {
+		return op, nil
+	}
+	if d.ops == nil && len(arg) == 1 {
+		return arg[0], nil
+	}
+	return 0, fmt.Errorf("no op %q", arg)
+}
+
+// value parses a cell or stack value, -128 to 255.
+func value(arg string) (int8, error) {
+	v, err := strconv.ParseInt(arg, 0, 16)
+	if err != nil || v < -128 || v > 255 {
+		return 0, fmt.Errorf("bad value %q", arg)
+	}
+	return int8(v), nil
+}
+
+func sorted[K int | uint8](m map[K]bool) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"links.org/bf/asm"
+	"links.org/bf/isa"
+	"links.org/bf/soup"
+)
+
+func TestDebugger(t *testing.T) {
+	src := `
+		PUSH 7
+		SWH		; the write head is 9
+		PUSH 5
+		WRITE
+		WRITE	; underflows
+		INC
+	`
+	p, err := asm.MustLookup("f6").Assemble(strings.NewReader(src))
+	assert.NilError(t, err)
+	u := make(soup.Universe, 64)
+	copy(u, p)
+	i, err := isa.New("f6", &soup.Config{SLen: 16, ILimit: 100, Strict: true})
+	assert.NilError(t, err)
+
+	var out bytes.Buffer
+	d := newDebugger(i, "f6", u, &out)
+	assert.NilError(t, d.start(0))
+	cmds := []string{"break op SWH", "watch 9", "continue", "continue", "info", "continue", "set stack 7", "set pc 4", "step", "x 9 1"}
+	assert.NilError(t, d.repl(strings.NewReader(strings.Join(cmds, "\n"))))
+	for _, want := range []string{
+		"breakpoint on SWH at 1",
+		"[9]=05",
+		"wrote watched cell 9",
+		"stack []\nheads [0 9]",
+		"halt underflow",
+		"[9]=07",
+		"w      9: 07 PUSH 7",
+	} {
+		assert.Assert(t, strings.Contains(out.String(), want), "%q not in\n%s", want, out.String())
+	}
+	assert.Equal(t, d.frame[9], uint8(0))
+}
@@ -0,0 +1,74 @@
+# Reads the logs written by the soup commands, see soup/log.go.
+import json
+import zlib
+
+MAGIC = b'SOUPLOG\x00'
+KEYFRAME = 0
+DELTA = 1
+INDEX = 2
+
+def read_long(s):
+    b = s.read(8)
+    if len(b) < 8:
+        raise EOFError()
+    return int.from_bytes(b, byteorder='little')
+
+class Log:
+    # ops says whether the frames of a legacy log have op counts, which
+    # depends on the program that wrote it
+    def __init__(self, name, ops=True):
+        self.f = open(name, 'rb')
+        if self.f.read(8) == MAGIC:
+            self.version = int.from_bytes(self.f.read(4), byteorder='little')
+            if self.version != 2:
+                raise ValueError('log version %d isn\'t 2' % self.version)
+            header = json.loads(self.f.read(int.from_bytes(self.f.read(4), byteorder='little')))
+            self.params = header['params']
+            self.fields = header['frame']
+        else:
+            self.f.seek(0)
+            self.version = 0
+            names = ('ulen', 'slen', 'ilimit', 'mutation_rate', 'runners')
+            self.params = {name: read_long(self.f) for name in names}
+            self.fields = [{'name': 'generation', 'type': 'u64'}]
+            if ops:
+                self.fields.append({'name': 'n_ops', 'type': 'u64'})
+            self.fields.append({'name': 'universe', 'type': 'u8', 'len': self.params['ulen']})
+        self.size = 0
+        for field in self.fields:
+            self.size += field.get('len', 1) * (8 if field['type'] == 'u64' else 1)
+
+    def read_raw(self):
+        if self.version == 0:
+            return self.f.read(self.size)
+        h = self.f.read(13)
+        if len(h) < 13 or h[0] == INDEX:
+            return None
+        payload = self.f.read(int.from_bytes(h[9:13], byteorder='little'))
+        try:
+            raw = zlib.decompress(payload, -15)
+        except zlib.error:
+            return None
+        if h[0] == DELTA:
+            raw = (int.from_bytes(raw, byteorder='little') ^ int.from_bytes(self.prev, byteorder='little')).to_bytes(len(raw), byteorder='little')
+        self.prev = raw
+        return raw
+
+    # Yields generation, n_ops and the universe for each frame, stopping at
+    # a frame that was cut short. n_ops is 0 if it wasn't logged.
+    def frames(self):
+        while True:
+            raw = self.read_raw()
+            if raw is None or len(raw) < self.size:
+                return
+            frame = {}
+            off = 0
+            for field in self.fields:
+                n = field.get('len', 1)
+                if field['type'] == 'u64':
+                    frame[field['name']] = int.from_bytes(raw[off:off+8], byteorder='little')
+                    off += 8 * n
+                else:
+                    frame[field['name']] = raw[off:off+n]
+                    off += n
+            yield frame['generation'], frame.get('n_ops', 0), frame['universe']
@@ -0,0 +1,189 @@
+/*
+soupreplay reads the logs written by the soup commands, of any version.
+
+	soupreplay list LOG
+	soupreplay show [-isa NAME] [-generation N] [-off N] [-n N] LOG
+	soupreplay extract [-from N] [-to N] LOG OUT
+
+list prints the generation and op count of every frame. show prints the
+header and the first frame at or after a generation, rendered with the ISA's
+glyphs. extract copies the frames between two generations, inclusive, to a
+new log.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"links.org/bf/isa"
+	"links.org/bf/soup"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: soupreplay list|show|extract [flags] LOG [OUT]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(os.Args[2:])
+	case "show":
+		err = show(os.Args[2:])
+	case "extract":
+		err = extract(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "soupreplay:", err)
+		os.Exit(1)
+	}
+}
+
+func open(fs *flag.FlagSet, args []string, n int) (*soup.LogReader, *os.File, error) {
+	fs.Parse(args)
+	if fs.NArg() != n {
+		usage()
+	}
+	return soup.OpenLog(fs.Arg(0))
+}
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	l, f, err := open(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for i := 0; ; i++ {
+		fr, err := l.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(i, fr.Generation, fr.NOps)
+	}
+}
+
+func show(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	name := fs.String("isa", "", "ISA to render with, if the log doesn't say: "+strings.Join(isa.Names(), ", "))
+	generation := fs.Uint64("generation", 0, "show the first frame at or after this generation")
+	off := fs.Int("off", 0, "first cell to show")
+	n := fs.Int("n", 0, "number of cells to show, 0 for all")
+	l, f, err := open(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := &l.Header
+	if *name == "" {
+		*name = h.ISA
+	}
+	if *name == "" {
+		return errors.New("the log doesn't say which ISA it is, use -isa")
+	}
+	c, err := h.Config()
+	if err != nil {
+		return err
+	}
+	i, err := isa.New(*name, c)
+	if err != nil {
+		return err
+	}
+
+	if err := l.SeekGeneration(*generation); err != nil {
+		return err
+	}
+	fr, err := l.Next()
+	if err == io.EOF {
+		return fmt.Errorf("no frame at or after generation %d", *generation)
+	}
+	if err != nil {
+		return err
+	}
+
+	if h.Legacy != "" {
+		fmt.Printf("legacy %s log\n", h.Legacy)
+	} else {
+		fmt.Printf("version %d log of %s, seed %d\n", h.Version, h.ISA, h.Seed)
+	}
+	j, err := soup.ConfigJSON(h.Params)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	fmt.Println("generation:", fr.Generation, "ops:", fr.NOps)
+	if *n == 0 {
+		*n = len(fr.Universe)
+	}
+	fr.Universe.Show(i, *off, *n)
+	fmt.Println()
+	return nil
+}
+
+func extract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	from := fs.Uint64("from", 0, "first generation")
+	to := fs.Uint64("to", math.MaxUint64, "last generation")
+	l, f, err := open(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := &l.Header
+	c, err := h.Config()
+	if err != nil {
+		return err
+	}
+	c.ULen = h.ULen()
+	// Keep any parameters the config doesn't know about too, and any fields
+	// after the universe
+	var fields []soup.Field
+	for i, f := range h.Frame {
+		if f.Name == "universe" {
+			fields = h.Frame[i+1:]
+		}
+	}
+	out, err := soup.NewFieldLogger(fs.Arg(1), h.ISA, c, fields, h.Params)
+	if err != nil {
+		return err
+	}
+
+	if err := l.SeekGeneration(*from); err != nil {
+		out.Close()
+		return err
+	}
+	for {
+		fr, err := l.Next()
+		if err == io.EOF || (err == nil && fr.Generation > *to) {
+			break
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+		values := make([][]byte, len(fields))
+		for i, f := range fields {
+			values[i] = fr.Fields[f.Name]
+		}
+		out.DumpFields(fr.Generation, fr.NOps, fr.Universe, values...)
+	}
+	return out.Close()
+}
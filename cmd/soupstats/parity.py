@@ -0,0 +1,64 @@
+# Checks soupstats against f5stats.py on the same log:
+#
+#   python3 cmd/f5/f5stats.py LOG > f5stats.out
+#   go run links.org/bf/cmd/soupstats LOG > soupstats.csv
+#   python3 cmd/soupstats/parity.py f5stats.out soupstats.csv
+#
+# Everything but the compression must match. f5stats.py uses brotli and
+# soupstats flate, so for cratio and entropy-cratio it reports how far apart
+# they are and how well they track each other.
+import math
+import sys
+
+def f5stats(name):
+    rows = []
+    with open(name) as f:
+        for line in f:
+            fields = [v.strip() for v in line.split(',')]
+            if len(fields) != 8 or fields[0] == 'generation':
+                continue
+            rows.append([None if v in ('None', '') else float(v) for v in fields])
+    return rows
+
+def soupstats(name):
+    rows = []
+    with open(name) as f:
+        next(f)
+        for line in f:
+            rows.append([None if v == '' else float(v) for v in line.strip().split(',')])
+    return rows
+
+def correlation(a, b):
+    n = len(a)
+    ma, mb = sum(a) / n, sum(b) / n
+    cov = sum((x - ma) * (y - mb) for x, y in zip(a, b))
+    va = math.sqrt(sum((x - ma) ** 2 for x in a))
+    vb = math.sqrt(sum((y - mb) ** 2 for y in b))
+    return cov / (va * vb) if va and vb else float('nan')
+
+py = f5stats(sys.argv[1])
+go = soupstats(sys.argv[2])
+ok = True
+if len(py) != len(go):
+    print(f'{len(py)} frames from f5stats.py, {len(go)} from soupstats')
+    ok = False
+
+names = ['generation', 'op_count', 'delta_gen', 'rate', 'cratio', 'entropy', 'entropy-cratio', 'changes']
+for col in (0, 1, 2, 3, 5, 7):
+    bad = 0
+    for p, g in zip(py, go):
+        if p[col] is None or g[col] is None:
+            if p[col] is not g[col]:
+                bad += 1
+        elif not math.isclose(p[col], g[col], rel_tol=1e-9, abs_tol=1e-12):
+            bad += 1
+    print(f'{names[col]:>15}: {"ok" if bad == 0 else f"{bad} frames differ"}')
+    ok = ok and bad == 0
+
+for col in (4, 6):
+    a = [p[col] for p in py]
+    b = [g[col] for g in go]
+    diff = sum(y - x for x, y in zip(a, b)) / len(a) if a else 0
+    print(f'{names[col]:>15}: mean soupstats - f5stats {diff:+.4f}, correlation {correlation(a, b):.4f}')
+
+sys.exit(0 if ok else 1)
@@ -0,0 +1,108 @@
+/*
+soupstats computes the complexity metrics of f5/f5stats.py over a soup log
+of any version, one frame at a time, and writes them as CSV.
+
+	soupstats [-from N] [-to N] [-o OUT] LOG
+
+The columns are the generation, op count, generations since the previous
+frame, ops per run since then, compressed bits per cell, Shannon entropy in
+bits per cell, high-order entropy (entropy less compressed bits) and the
+number of cells changed since the previous frame. The first frame is
+measured from itself, so it has no new generations and no changes, and a
+frame with no new generations has no rate.
+
+f5stats.py compresses with brotli where soupstats uses flate, so the
+compressed bits are a little higher and the high-order entropy a little
+lower, but they rise and fall together; parity.py compares the two.
+*/
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"links.org/bf/soup"
+)
+
+func main() {
+	from := flag.Uint64("from", 0, "first generation")
+	to := flag.Uint64("to", math.MaxUint64, "last generation")
+	out := flag.String("o", "", "write the CSV here rather than to stdout")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: soupstats [-from N] [-to N] [-o OUT] LOG")
+		os.Exit(2)
+	}
+	if err := stats(flag.Arg(0), *from, *to, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "soupstats:", err)
+		os.Exit(1)
+	}
+}
+
+func stats(name string, from uint64, to uint64, out string) error {
+	l, f, err := soup.OpenLog(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := l.SeekGeneration(from); err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if out != "" {
+		if w, err = os.Create(out); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	c := csv.NewWriter(w)
+	c.Write([]string{"generation", "n_ops", "delta_gen", "rate", "cratio", "entropy", "high_order", "changes"})
+
+	g := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	var p_generation, p_n_ops uint64
+	var prev soup.Universe
+	for first := true; ; first = false {
+		fr, err := l.Next()
+		if err == io.EOF || (err == nil && fr.Generation > to) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			p_generation, p_n_ops = fr.Generation, fr.NOps
+		}
+		u := fr.Universe
+		cratio := u.CompressedBits()
+		e := u.Entropy()
+		record := []string{
+			strconv.FormatUint(fr.Generation, 10),
+			strconv.FormatUint(fr.NOps, 10),
+			strconv.FormatUint(fr.Generation-p_generation, 10),
+			"",
+			g(cratio),
+			g(e),
+			g(e - cratio),
+			"",
+		}
+		if fr.Generation != p_generation {
+			record[3] = g(float64(fr.NOps-p_n_ops) / float64(fr.Generation-p_generation))
+		}
+		if prev != nil {
+			record[7] = strconv.Itoa(soup.Changes(prev, u))
+		}
+		c.Write(record)
+		p_generation, p_n_ops = fr.Generation, fr.NOps
+		prev = u
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func read(t *testing.T, name string) [][]string {
+	f, err := os.Open(name)
+	assert.NilError(t, err)
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	assert.NilError(t, err)
+	return rows[1:]
+}
+
+// testdata/f5stats.out is f5stats.py's output for testdata/sample.log, run
+// with stand-ins for brotli and the plotting modules, so the compressed
+// bits aren't compared.
+func TestParity(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stats.csv")
+	assert.NilError(t, stats("testdata/sample.log", 0, 1<<63, out))
+	want, got := read(t, "testdata/f5stats.out"), read(t, out)
+	assert.Equal(t, len(got), len(want))
+	for i := range want {
+		// generation, n_ops, delta_gen, rate, entropy and changes
+		for _, col := range []int{0, 1, 2, 3, 5, 7} {
+			p, g := want[i][col], got[i][col]
+			if p == "None" {
+				assert.Equal(t, g, "", "row %d column %d", i, col)
+				continue
+			}
+			pv, err := strconv.ParseFloat(p, 64)
+			assert.NilError(t, err)
+			gv, err := strconv.ParseFloat(g, 64)
+			assert.NilError(t, err)
+			assert.Assert(t, pv-gv < 1e-9 && gv-pv < 1e-9, "row %d column %d: %s != %s", i, col, p, g)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stats.csv")
+	assert.NilError(t, stats("testdata/sample.log", 200, 1<<63, out))
+	rows := read(t, out)
+	// The first frame, at 250, is measured from itself, not generation 0
+	assert.Equal(t, strings.Join(rows[0][:4], ","), "250,2900,0,")
+	assert.Equal(t, strings.Join(rows[2][:4], ","), "500,6400,250,14")
+}
@@ -0,0 +1,103 @@
+/*
+souptrace runs one program of a logged universe, or of a file of bytes, a
+step at a time, and prints what each step did: the pc and op, the stack and
+heads after it, and the cells it wrote. It works for the ISAs that can run a
+step at a time, f5, f6 and bfsoup, and runs exactly as their soups do.
+
+	souptrace [-isa NAME] [-generation N] [-pc N] [-json] [-o OUT] LOG
+	souptrace -raw -isa NAME [-pc N] [-json] [-o OUT] FILE
+
+The stack length, iteration limit and strictness come from the log, or can
+be given with -slen, -ilimit and -strict. With -json each step is a line of
+JSON.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"links.org/bf/asm"
+	"links.org/bf/isa"
+	"links.org/bf/soup"
+)
+
+func main() {
+	if err := trace(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "souptrace:", err)
+		os.Exit(1)
+	}
+}
+
+func trace(args []string) error {
+	fs := flag.NewFlagSet("souptrace", flag.ExitOnError)
+	name := fs.String("isa", "", "ISA, if the log doesn't say: "+strings.Join(isa.Names(), ", "))
+	raw := fs.Bool("raw", false, "FILE is bytes, not a log")
+	generation := fs.Uint64("generation", 0, "trace in the first frame at or after this generation")
+	pc := fs.Int("pc", 0, "where the program starts")
+	jsonl := fs.Bool("json", false, "write JSON lines rather than text")
+	out := fs.String("o", "", "write here rather than to stdout")
+	c := &soup.Config{SLen: 1024, ILimit: 1_000, Strict: true}
+	fs.IntVar(&c.SLen, "slen", c.SLen, "stack length")
+	fs.IntVar(&c.ILimit, "ilimit", c.ILimit, "iteration limit")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "halt programs that do something illegal")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: souptrace [flags] LOG|FILE")
+		os.Exit(2)
+	}
+
+	var u soup.Universe
+	if *raw {
+		b, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		u = b
+	} else {
+		h, fr, err := soup.ReadFrame(fs.Arg(0), *generation)
+		if err != nil {
+			return err
+		}
+		if *name == "" {
+			*name = h.ISA
+		}
+		if err := h.Limits(c, fs); err != nil {
+			return err
+		}
+		u = fr.Universe
+	}
+	if *name == "" {
+		return errors.New("the log doesn't say which ISA it is, use -isa")
+	}
+	if len(u) == 0 {
+		return errors.New("nothing to trace")
+	}
+	i, err := isa.New(*name, c)
+	if err != nil {
+		return err
+	}
+	mnemonic := i.Glyph
+	if d, err := asm.Lookup(*name); err == nil {
+		mnemonic = d.Mnemonic
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	step, flush := soup.TraceWriter(w, *jsonl, mnemonic)
+	if err := soup.Trace(i, u, soup.Pmod(*pc, len(u)), step); err != nil {
+		return err
+	}
+	return flush()
+}
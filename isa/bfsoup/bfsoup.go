@@ -0,0 +1,302 @@
+/*
+Package bfsoup is the instruction set of the bfsoup soup.
+
+<          Decrement head 0
+>          Increment head 0
+{		   Decrement head 1
+}		   Increment head 1
++		   Increment cell at head 0
+-		   Decrement cell at head 0
+.		   Copy cell at head 0 to head 1
+,		   Copy cell at head 1 to head 0
+[		   Beginning of loop (error if no matching ]) - go to end if *head0 == 0
+]		   End of loop (error if no matching [) - go to beginning if *head0 != 0
+!		   Place head 0 here
+?		   Place head 1 here
+
+a          Add 2 to head 0
+b          Add 4 to head 0
+c          Add 8 to head 0
+d          Add 16 to head 0
+e          Add 32 to head 0
+f          Add 64 to head 0
+g          Add 128 to head 0
+
+z		  Subtract 2 from head 0
+y		  Subtract 4 from head 0
+x		  Subtract 8 from head 0
+w		  Subtract 16 from head 0
+v		  Subtract 32 from head 0
+u		  Subtract 64 from head 0
+t		  Subtract 128 from head 0
+
+A		  Add 2 to head 1
+B		  Add 4 to head 1
+C		  Add 8 to head 1
+D		  Add 16 to head 1
+E		  Add 32 to head 1
+F		  Add 64 to head 1
+G		  Add 128 to head 1
+
+Z		  Subtract 2 from head 1
+Y		  Subtract 4 from head 1
+X		  Subtract 8 from head 1
+W		  Subtract 16 from head 1
+V		  Subtract 32 from head 1
+U		  Subtract 64 from head 1
+T		  Subtract 128 from head 1
+*/
+package bfsoup
+
+import (
+	"fmt"
+
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+// Ops is the bfsoup instruction set, of which random ops are drawn evenly.
+// The ops after ']' above are not in it.
+var Ops = soup.NewOpTable(0,
+	soup.Op{Code: '<', Glyph: "<", Weight: 1},
+	soup.Op{Code: '>', Glyph: ">", Weight: 1},
+	soup.Op{Code: '{', Glyph: "{", Weight: 1},
+	soup.Op{Code: '}', Glyph: "}", Weight: 1},
+	soup.Op{Code: '+', Glyph: "+", Weight: 1},
+	soup.Op{Code: '-', Glyph: "-", Weight: 1},
+	soup.Op{Code: '.', Glyph: ".", Weight: 1},
+	soup.Op{Code: ',', Glyph: ",", Weight: 1},
+	soup.Op{Code: '[', Glyph: "[", Weight: 1},
+	soup.Op{Code: ']', Glyph: "]", Weight: 1},
+)
+
+// ISA runs bfsoup programs for at most ILimit steps. There is no stack.
+type ISA struct {
+	ILimit int
+}
+
+func New(c *soup.Config) *ISA {
+	return &ISA{ILimit: c.ILimit}
+}
+
+func (isa *ISA) Run(program []uint8, pc int) int {
+	return isa.RunTraced(program, pc, nil)
+}
+
+// RunTraced is Run, reporting each cell written to wrote if it isn't nil:
+// copied by '.' and ',', or changed by '+' and '-'.
+func (isa *ISA) RunTraced(program []uint8, pc int, wrote func(dst int, src int)) int {
+	return isa.RunProfiled(program, pc, wrote, nil)
+}
+
+// RunProfiled is RunTraced, counting each op executed in prof if it isn't
+// nil, and why the run halted.
+func (isa *ISA) RunProfiled(program []uint8, pc int, wrote func(dst int, src int), prof *soup.Profile) int {
+	m := isa.NewMachine(program, pc, wrote)
+	m.Profile = prof
+	for m.Step() {
+	}
+	return m.Iterations
+}
+
+// Machine is a program part way through a run, which Step runs an op at a
+// time: all the runs above are Step until it returns false.
+type Machine struct {
+	ISA        *ISA
+	Program    []uint8
+	PC         int
+	Head0      int
+	Head1      int
+	Iterations int
+	Halted     bool
+	Halt       soup.Halt // Why, once Halted
+
+	Wrote   func(dst int, src int) // As for RunTraced
+	Profile *soup.Profile          // As for RunProfiled
+
+	op uint8 // The last op, which a halt is blamed on
+}
+
+// NewMachine starts program at pc, with head 0 there and head 1 12 cells
+// on.
+func (isa *ISA) NewMachine(program []uint8, pc int, wrote func(dst int, src int)) *Machine {
+	return &Machine{ISA: isa, Program: program, PC: pc, Head0: pc, Head1: pc + 12, Wrote: wrote}
+}
+
+func (isa *ISA) Machine(program []uint8, pc int, wrote func(dst int, src int)) soup.Machine {
+	return isa.NewMachine(program, pc, wrote)
+}
+
+// State gives the heads wrapped into the universe, as Step does before
+// using them.
+func (m *Machine) State() soup.State {
+	return soup.State{
+		PC:         m.PC,
+		Heads:      []int{soup.Pmod(m.Head0, len(m.Program)), soup.Pmod(m.Head1, len(m.Program))},
+		Iterations: m.Iterations,
+		Halted:     m.Halted,
+		Halt:       m.Halt,
+	}
+}
+
+func (m *Machine) SetState(s soup.State) error {
+	if len(s.Stack) != 0 {
+		return fmt.Errorf("bfsoup has no stack")
+	}
+	if len(s.Heads) != 2 {
+		return fmt.Errorf("bfsoup has 2 heads, not %d", len(s.Heads))
+	}
+	m.PC = soup.Pmod(s.PC, len(m.Program))
+	m.Head0, m.Head1 = s.Heads[0], s.Heads[1]
+	m.Iterations, m.Halted, m.Halt = s.Iterations, s.Halted, s.Halt
+	return nil
+}
+
+func (m *Machine) halt(h soup.Halt) bool {
+	m.Halted, m.Halt = true, h
+	if m.Profile != nil {
+		m.Profile.Halted(h, m.op)
+	}
+	return false
+}
+
+// Step runs the op at PC, reporting whether the program carries on. Like
+// Run it counts the iteration that hits the limit, which runs no op.
+func (m *Machine) Step() bool {
+	if m.Halted {
+		return false
+	}
+	if m.Iterations++; m.Iterations > m.ISA.ILimit {
+		return m.halt(soup.ILIMIT)
+	}
+
+	m.Head0 = soup.Pmod(m.Head0, len(m.Program))
+	m.Head1 = soup.Pmod(m.Head1, len(m.Program))
+
+	op := m.Program[m.PC]
+	m.op = op
+	if m.Profile != nil {
+		m.Profile.Ops[op]++
+	}
+	switch op {
+	case '<':
+		m.Head0 -= 1
+	case '>':
+		m.Head0 += 1
+	case '{':
+		m.Head1 -= 1
+	case '}':
+		m.Head1 += 1
+	case '+':
+		m.Program[m.Head0]++
+		if m.Wrote != nil {
+			m.Wrote(m.Head0, -1)
+		}
+	case '-':
+		m.Program[m.Head0]--
+		if m.Wrote != nil {
+			m.Wrote(m.Head0, -1)
+		}
+	case '.':
+		m.Program[m.Head1] = m.Program[m.Head0]
+		if m.Wrote != nil {
+			m.Wrote(m.Head1, m.Head0)
+		}
+		/*
+			copy = m.Program[m.Head0]
+			copy_set = true
+		*/
+	case ',':
+		m.Program[m.Head0] = m.Program[m.Head1]
+		if m.Wrote != nil {
+			m.Wrote(m.Head0, m.Head1)
+		}
+		/*
+			if !copy_set {
+				return m.halt(soup.UNDERFLOW)
+			}
+			m.Program[m.Head1] = copy
+			copy_set = false
+		*/
+	case '[':
+		npc := soup.Pmod(m.PC+1, len(m.Program))
+		count := 1
+		for npc != m.PC {
+			if m.Program[npc] == '[' {
+				count++
+			} else if m.Program[npc] == ']' {
+				count--
+			}
+			if count == 0 {
+				break
+			}
+			npc = soup.Pmod(npc+1, len(m.Program))
+		}
+		if npc == m.PC {
+			return m.halt(soup.UNMATCHED)
+		}
+		if m.Program[m.Head0] != 0 {
+			break
+		}
+		m.PC = soup.Pmod(npc+1, len(m.Program))
+	case ']':
+		npc := soup.Pmod(m.PC-1, len(m.Program))
+		count := 1
+		for npc != m.PC {
+			if m.Program[npc] == '[' {
+				count--
+			} else if m.Program[npc] == ']' {
+				count++
+			}
+			if count == 0 {
+				break
+			}
+			npc = soup.Pmod(npc-1, len(m.Program))
+		}
+		if npc == m.PC {
+			return m.halt(soup.UNMATCHED)
+		}
+		if m.Program[m.Head0] == 0 {
+			break
+		}
+		m.PC = soup.Pmod(npc+1, len(m.Program))
+		/*
+			case '!':
+				m.Head0 = m.PC
+			case '?':
+				m.Head1 = m.PC
+		*/
+		/*
+			case 'a':
+				m.Head0 += 2
+			case 'A':
+				m.Head1 += 2
+			case 'z':
+				m.Head0 -= 2
+			case 'Z':
+				m.Head1 -= 2
+		*/
+		/*
+			default:
+				switch {
+				case op >= 'a' && op <= 'g':
+					m.Head0 += 1 << int(op-'a')
+				case op >= 't' && op <= 'z':
+					m.Head0 -= 256 >> int(op-'t')
+				case op >= 'A' && op <= 'G':
+					m.Head1 += 1 << int(op-'A')
+				case op >= 'T' && op <= 'Z':
+					m.Head1 -= 256 >> int(op-'T')
+				default:
+					m.Iterations--
+				}
+		*/
+		//		default:
+		//			m.Iterations--
+	}
+	m.PC = (m.PC + 1) % len(m.Program)
+	return true
+}
+
+func (*ISA) Glyph(op uint8) string       { return Ops.Glyph(op) }
+func (*ISA) RandomOp(r *rand.Rand) uint8 { return Ops.RandomOp(r) }
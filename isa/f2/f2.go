@@ -0,0 +1,194 @@
+/*
+Package f2 is the instruction set of the f2 soup.
+
+8 bit processor
+
+push <n> -> <1>                                                 1nnn nnnn
+pop <1> -> <>                                                   0000 0000
+not <1> -> <1>              bitwise not                         0000 0001
+add <1>, <2> -> <1>                                             0000 0002
+mul <1>, <2> -> <1>, <2>                                        0000 0003
+store <1>, <2> -> <>        stores <1> at <2> % PLEN            0000 0004
+dup <1> -> <1>, <2>                                             0000 0005
+jump <1> -> <>              is also return                      0000 0006
+jnz <1>, <2>                jump to <1> % PLEN if <2> nz        0000 0007
+load <1> -> <1>                                                 0000 0008
+swap <1>, <2> -> <2>, <1>                                       0000 0009
+copy <1>, <2> -> <1>        copy <1> to <1> + <2>               0000 000a
+call <1> -> <1>             call <1> % PLEN                     0000 000b
+stop															0000 000c
+loc <> -> <1>               push pc to stack                    0000 000d
+*/
+package f2
+
+import (
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+const (
+	PUSH  = 0x80
+	POP   = 0x00
+	NOT   = 0x01
+	ADD   = 0x02
+	MUL   = 0x03
+	STORE = 0x04
+	DUP   = 0x05
+	JUMP  = 0x06
+	JNZ   = 0x07
+	LOAD  = 0x08
+	SWAP  = 0x09
+	COPY  = 0x0a
+	CALL  = 0x0b
+	STOP  = 0x0c
+	LOC   = 0x0d
+)
+
+// Ops is the f2 instruction set. PUSH takes the low seven bits of its code
+// as an operand, so it has a row for each 16 of its codes. Random ops are
+// POP to LOC, or a fifth of the time any byte. Run makes its own stack
+// checks rather than the table's.
+var Ops = soup.NewOpTable(7, append(pushes(),
+	soup.Op{Code: POP, Mnemonic: "POP", Glyph: "p", In: 1, Weight: 2},
+	soup.Op{Code: NOT, Mnemonic: "NOT", Glyph: "~", In: 1, Out: 1, Weight: 2},
+	soup.Op{Code: ADD, Mnemonic: "ADD", Glyph: "+", In: 2, Out: 1, Weight: 2},
+	soup.Op{Code: MUL, Mnemonic: "MUL", Glyph: "*", In: 2, Out: 2, Weight: 2},
+	soup.Op{Code: STORE, Mnemonic: "STORE", Glyph: "S", In: 2, Weight: 2},
+	soup.Op{Code: DUP, Mnemonic: "DUP", Glyph: "D", In: 1, Out: 2, Weight: 2},
+	soup.Op{Code: JUMP, Mnemonic: "JUMP", Glyph: "<", In: 1, Address: true, Weight: 2},
+	soup.Op{Code: JNZ, Mnemonic: "JNZ", Glyph: "Z", In: 2, Address: true, Weight: 2},
+	soup.Op{Code: LOAD, Mnemonic: "LOAD", Glyph: "L", In: 1, Out: 1, Weight: 2},
+	soup.Op{Code: SWAP, Mnemonic: "SWAP", Glyph: "X", In: 2, Out: 2, Weight: 2},
+	soup.Op{Code: COPY, Mnemonic: "COPY", Glyph: "C", In: 2, Out: 1, Weight: 2},
+	soup.Op{Code: CALL, Mnemonic: "CALL", Glyph: ">", In: 1, Out: 1, Address: true, Weight: 2},
+	soup.Op{Code: STOP, Mnemonic: "STOP", Glyph: "!", Weight: 2},
+	soup.Op{Code: LOC, Mnemonic: "LOC", Glyph: "l", Out: 1, Weight: 2},
+)...)
+
+func pushes() []soup.Op {
+	var ops []soup.Op
+	for c := PUSH; c <= 0xff; c += 0x10 {
+		ops = append(ops, soup.Op{Code: uint8(c), Nibble: true, Mnemonic: "PUSH", Glyph: "P", Out: 1})
+	}
+	return ops
+}
+
+// ISA runs f2 programs with a configuration's stack length and iteration
+// limit. f2 is always strict.
+type ISA struct {
+	SLen   int
+	ILimit int
+}
+
+func New(c *soup.Config) *ISA {
+	return &ISA{SLen: c.SLen, ILimit: c.ILimit}
+}
+
+func (isa *ISA) Run(program []uint8, pc int) int {
+	stack := make([]int16, isa.SLen)
+	sp := 0
+	iterations := 0
+outer:
+	for {
+		if iterations > isa.ILimit || sp > isa.SLen || sp < 0 {
+			break
+		}
+		iterations++
+		pc = soup.Pmod(pc, len(program))
+		op := program[pc]
+		pc++
+		if op&PUSH == PUSH {
+			if sp >= isa.SLen {
+				break outer
+			}
+			stack[sp] = int16(op & 0x7f)
+			if op&0x40 == 0x40 {
+				stack[sp] = -stack[sp]
+			}
+			sp++
+			continue
+		}
+		switch op {
+		case POP:
+			sp--
+		case NOT:
+			if sp < 1 {
+				break outer
+			}
+			stack[sp-1] = ^stack[sp-1]
+		case ADD:
+			if sp--; sp < 1 {
+				break outer
+			}
+			stack[sp-1] += stack[sp]
+		case MUL:
+			if sp < 2 {
+				break outer
+			}
+			t := uint32(stack[sp-1]) * uint32(stack[sp-2])
+			stack[sp-1] = int16(t >> 16)
+			stack[sp-2] = int16(t & 0xffff)
+		case STORE:
+			if sp -= 2; sp < 0 {
+				break outer
+			}
+			program[soup.Pmod(int(stack[sp]), len(program))] = uint8(stack[sp+1] & 0xff)
+		case DUP:
+			if sp < 1 || sp >= isa.SLen {
+				break outer
+			}
+			stack[sp] = stack[sp-1]
+			sp++
+		case JUMP:
+			if sp--; sp < 0 {
+				break outer
+			}
+			pc = (pc + int(stack[sp])) % len(program)
+		case JNZ:
+			if sp -= 2; sp < 0 {
+				break outer
+			}
+			if stack[sp] != 0 {
+				pc = (pc + int(stack[sp+1])) % len(program)
+			}
+		case LOAD:
+			if sp < 1 {
+				break outer
+			}
+			stack[sp-1] = int16(program[soup.Pmod(int(stack[sp-1]), len(program))])
+			sp++
+		case SWAP:
+			if sp < 2 {
+				break outer
+			}
+			t := stack[sp-1]
+			stack[sp-1] = stack[sp-2]
+			stack[sp-2] = t
+		case COPY:
+			if sp < 2 {
+				break outer
+			}
+			program[soup.Pmod(int(stack[sp-2]+stack[sp-1]), len(program))] = program[soup.Pmod(int(stack[sp-2]), len(program))]
+			sp--
+		case CALL:
+			if sp < 1 {
+				break outer
+			}
+			t := stack[sp-1]
+			stack[sp-1] = int16(pc)
+			pc = (pc + int(t)) % len(program)
+		case STOP:
+			break outer
+		case LOC:
+			if sp >= isa.SLen {
+				break outer
+			}
+			stack[sp] = int16(pc)
+			sp++
+		}
+	}
+	return iterations
+}
+
+func (*ISA) Glyph(op uint8) string       { return Ops.Glyph(op) }
+func (*ISA) RandomOp(r *rand.Rand) uint8 { return Ops.RandomOp(r) }
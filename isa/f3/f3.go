@@ -0,0 +1,121 @@
+/*
+Package f3 is the instruction set of the f3 soup.
+
+0000 xxxx	Push [xxxx], sign extended
+0001 xxxx	<top> = (<top> << 4) + [xxxx]
+0010 0000	Copy *(<pc> + <top - 1>) to *(<pc> + <top - 1> + <top>), pop 1
+0010 0001	Inc <top>
+0010 0010	Dec <top>
+0010 0011	Jump to <pc> + <top - 1> if <top> != 0, pop 2
+*/
+package f3
+
+import (
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+const (
+	PUSH       = 0x00
+	SHIFT_PUSH = 0x10
+	COPY       = 0x20
+	INC        = 0x21
+	DEC        = 0x22
+	JNZ        = 0x23
+	MAX_OP     = JNZ
+)
+
+// Ops is the f3 instruction set.
+var Ops = soup.NewOpTable(36,
+	soup.Op{Code: PUSH, Nibble: true, Mnemonic: "PUSH", Glyph: "P", Out: 1, Weight: 1},
+	soup.Op{Code: SHIFT_PUSH, Nibble: true, Mnemonic: "SHIFT_PUSH", Glyph: "S", In: 1, Out: 1, Weight: 1},
+	soup.Op{Code: COPY, Mnemonic: "COPY", Glyph: "C", In: 2, Out: 1, Address: true, Weight: 28},
+	soup.Op{Code: INC, Mnemonic: "INC", Glyph: "I", In: 1, Out: 1, Weight: 28},
+	soup.Op{Code: DEC, Mnemonic: "DEC", Glyph: "D", In: 1, Out: 1, Weight: 28},
+	soup.Op{Code: JNZ, Mnemonic: "JNZ", Glyph: "J", In: 2, Address: true, Weight: 28},
+)
+
+// ISA is the f3 machine, sized by a configuration.
+type ISA struct {
+	SLen   int
+	ILimit int
+	Strict bool
+}
+
+func New(c *soup.Config) *ISA {
+	return &ISA{SLen: c.SLen, ILimit: c.ILimit, Strict: c.Strict}
+}
+
+func (isa *ISA) Run(program []uint8, pc int) int {
+	return isa.RunTraced(program, pc, nil)
+}
+
+// RunTraced is Run, reporting each cell COPY writes to wrote if it isn't nil.
+func (isa *ISA) RunTraced(program []uint8, pc int, wrote func(dst int, src int)) int {
+	return isa.RunProfiled(program, pc, wrote, nil)
+}
+
+// RunProfiled is RunTraced, counting each op executed in prof if it isn't
+// nil, and why the run halted.
+func (isa *ISA) RunProfiled(program []uint8, pc int, wrote func(dst int, src int), prof *soup.Profile) int {
+	stack := make([]int8, isa.SLen)
+	sp := 0
+	iterations := 0
+	halt := soup.ILIMIT
+	var op uint8
+
+	for {
+		if iterations++; iterations > isa.ILimit {
+			break
+		}
+
+		op = program[pc]
+		pc = (pc + 1) % len(program)
+		if prof != nil {
+			prof.Ops[op]++
+		}
+		o := Ops.Lookup(op)
+		if o == nil {
+			continue
+		}
+		if h := o.Check(sp, isa.SLen); h != soup.NONE {
+			if isa.Strict {
+				halt = h
+				break
+			}
+			continue
+		}
+		switch o.Code {
+		case PUSH:
+			stack[sp] = soup.SignExtend(op & 0x0f)
+			sp++
+		case SHIFT_PUSH:
+			stack[sp-1] = (stack[sp-1] << 4) + int8(op&0x0f)
+		case COPY:
+			loc := soup.Pmod(pc+int(stack[sp-2]), len(program))
+			off := int(stack[sp-1])
+			dst := soup.Pmod(loc+off, len(program))
+			program[dst] = program[loc]
+			if wrote != nil {
+				wrote(dst, loc)
+			}
+			sp-- // Leave the destination on the stack
+		case INC:
+			stack[sp-1]++
+		case DEC:
+			stack[sp-1]--
+		case JNZ:
+			if stack[sp-1] != 0 {
+				pc = soup.Pmod(pc+int(stack[sp-2]), len(program))
+			}
+			sp -= 2
+		}
+	}
+	if prof != nil {
+		prof.Halted(halt, op)
+	}
+	return iterations
+}
+
+func (*ISA) Glyph(op uint8) string       { return Ops.Glyph(op) }
+func (*ISA) RandomOp(r *rand.Rand) uint8 { return Ops.RandomOp(r) }
@@ -0,0 +1,328 @@
+/*
+Package f6 is the instruction set of the f6 soup.
+
+0000 xxxx	Push [xxxx], sign extended
+0001 xxxx	<top> = (<top> << 4) + [xxxx]
+0010 0000	Copy *(<pc> + <top - 1>) to *(<pc> + <top - 1> + <top>), pop 1
+0010 0001	Inc <top>
+0010 0010	Dec <top>
+0010 0011	Jump to <pc> + <top - 1> if <top> != 0, pop 2
+0010 0100   Duplicate <top>
+0010 0101   Swap <top> and <top - 1>
+0010 0110   Rotate the top <top> elements, pop 1
+0010 0111   Load: replace <top> with *(<pc> + <top>)
+0010 1000   Store: store <top - 1> at <pc> + <top>, pop 2
+0010 1001   Add <top> and <top - 1>, pop 1
+0010 1010   Set Read Head to <pc> + <top>
+0010 1011   Set Write Head to <pc> + <top>
+0010 1100   Read: Push *<read head>
+0010 1101   Write: Pop <top> and write to *<write head>
+0010 1110	Inc Read Head
+0010 1111	Inc Write Head
+*/
+package f6
+
+import (
+	"fmt"
+
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+const (
+	PUSH       = 0x00
+	SHIFT_PUSH = 0x10
+	COPY       = 0x20
+	INC        = 0x21
+	DEC        = 0x22
+	JNZ        = 0x23
+	DUP        = 0x24
+	SWAP       = 0x25
+	ROT        = 0x26
+	LOAD       = 0x27
+	STORE      = 0x28
+	ADD        = 0x29
+	SRH        = 0x2a
+	SWH        = 0x2b
+	READ       = 0x2c
+	WRITE      = 0x2d
+	INC_RH     = 0x2e
+	INC_WH     = 0x2f
+	MAX_OP     = INC_WH
+)
+
+// Ops is the f6 instruction set. COPY's code is still drawn and shown but
+// does nothing, and has no mnemonic so that it disassembles as a byte.
+var Ops = soup.NewOpTable(48,
+	soup.Op{Code: PUSH, Nibble: true, Mnemonic: "PUSH", Glyph: "P", Out: 1, Weight: 1},
+	soup.Op{Code: SHIFT_PUSH, Nibble: true, Mnemonic: "SHIFT_PUSH", Glyph: "S", In: 1, Out: 1, Weight: 1},
+	soup.Op{Code: COPY, Glyph: "C", Weight: 10},
+	soup.Op{Code: INC, Mnemonic: "INC", Glyph: ">", In: 1, Out: 1, Weight: 10},
+	soup.Op{Code: DEC, Mnemonic: "DEC", Glyph: "<", In: 1, Out: 1, Weight: 10},
+	soup.Op{Code: JNZ, Mnemonic: "JNZ", Glyph: "J", In: 2, Address: true, Weight: 10},
+	soup.Op{Code: DUP, Mnemonic: "DUP", Glyph: "=", In: 1, Out: 2, Weight: 10},
+	soup.Op{Code: SWAP, Mnemonic: "SWAP", Glyph: "X", In: 2, Out: 2, Weight: 10},
+	soup.Op{Code: ROT, Mnemonic: "ROT", Glyph: "O", Weight: 10}, // Does nothing on an empty stack
+	soup.Op{Code: LOAD, Mnemonic: "LOAD", Glyph: "^", In: 1, Out: 1, Address: true, Weight: 10},
+	soup.Op{Code: STORE, Mnemonic: "STORE", Glyph: "v", In: 2, Address: true, Weight: 10},
+	soup.Op{Code: ADD, Mnemonic: "ADD", Glyph: "+", In: 2, Out: 1, Weight: 10},
+	soup.Op{Code: SRH, Mnemonic: "SRH", Glyph: "r", In: 1, Address: true, Weight: 10},
+	soup.Op{Code: SWH, Mnemonic: "SWH", Glyph: "w", In: 1, Address: true, Weight: 10},
+	soup.Op{Code: READ, Mnemonic: "READ", Glyph: "R", Out: 1, Weight: 10},
+	soup.Op{Code: WRITE, Mnemonic: "WRITE", Glyph: "W", In: 1, Weight: 10},
+	soup.Op{Code: INC_RH, Mnemonic: "INC_RH", Glyph: "i", Weight: 10},
+	soup.Op{Code: INC_WH, Mnemonic: "INC_WH", Glyph: "j", Weight: 10},
+)
+
+// ISA runs f6 programs, with the limits taken from the soup's
+// configuration by New.
+type ISA struct {
+	SLen   int
+	ILimit int
+	Strict bool
+}
+
+func New(c *soup.Config) *ISA {
+	return &ISA{SLen: c.SLen, ILimit: c.ILimit, Strict: c.Strict}
+}
+
+func (isa *ISA) Run(program []uint8, pc int) int {
+	return isa.RunTraced(program, pc, nil)
+}
+
+// RunTraced is Run, reporting each cell STORE or WRITE writes to wrote if it
+// isn't nil. To know where the value came from it keeps, beside the stack,
+// the cell each entry was read from, or -1 if it was computed.
+func (isa *ISA) RunTraced(program []uint8, pc int, wrote func(dst int, src int)) int {
+	return isa.RunProfiled(program, pc, wrote, nil)
+}
+
+// RunProfiled is RunTraced, counting each op executed in prof if it isn't
+// nil, and why the run halted.
+func (isa *ISA) RunProfiled(program []uint8, pc int, wrote func(dst int, src int), prof *soup.Profile) int {
+	m := isa.NewMachine(program, pc, wrote)
+	m.Profile = prof
+	for m.Step() {
+	}
+	return m.Iterations
+}
+
+// Machine is a program part way through a run, which Step runs an op at a
+// time: all the runs above are Step until it returns false.
+type Machine struct {
+	ISA        *ISA
+	Program    []uint8
+	PC         int
+	Stack      []int8 // SLen long, of which SP are in use
+	SP         int
+	ReadHead   int
+	WriteHead  int
+	Iterations int
+	Halted     bool
+	Halt       soup.Halt // Why, once Halted
+
+	Wrote   func(dst int, src int) // As for RunTraced
+	Profile *soup.Profile          // As for RunProfiled
+
+	srcs []int // Beside Stack, if Wrote is set
+	op   uint8 // The last op, which a halt is blamed on
+}
+
+// NewMachine starts program at pc.
+func (isa *ISA) NewMachine(program []uint8, pc int, wrote func(dst int, src int)) *Machine {
+	m := &Machine{ISA: isa, Program: program, PC: pc, Stack: make([]int8, isa.SLen), Wrote: wrote}
+	if wrote != nil {
+		m.srcs = make([]int, isa.SLen)
+	}
+	return m
+}
+
+func (isa *ISA) Machine(program []uint8, pc int, wrote func(dst int, src int)) soup.Machine {
+	return isa.NewMachine(program, pc, wrote)
+}
+
+func (m *Machine) State() soup.State {
+	return soup.State{
+		PC:         m.PC,
+		Stack:      append([]int8{}, m.Stack[:m.SP]...),
+		Heads:      []int{m.ReadHead, m.WriteHead},
+		Iterations: m.Iterations,
+		Halted:     m.Halted,
+		Halt:       m.Halt,
+	}
+}
+
+// SetState keeps the source of each stack entry it leaves unchanged.
+func (m *Machine) SetState(s soup.State) error {
+	if len(s.Stack) > len(m.Stack) {
+		return fmt.Errorf("a stack of %d won't fit in %d", len(s.Stack), len(m.Stack))
+	}
+	if len(s.Heads) != 2 {
+		return fmt.Errorf("f6 has 2 heads, not %d", len(s.Heads))
+	}
+	if m.srcs != nil {
+		for i, v := range s.Stack {
+			if i >= m.SP || m.Stack[i] != v {
+				m.srcs[i] = -1
+			}
+		}
+	}
+	m.PC = soup.Pmod(s.PC, len(m.Program))
+	m.SP = copy(m.Stack, s.Stack)
+	m.ReadHead = soup.Pmod(s.Heads[0], len(m.Program))
+	m.WriteHead = soup.Pmod(s.Heads[1], len(m.Program))
+	m.Iterations, m.Halted, m.Halt = s.Iterations, s.Halted, s.Halt
+	return nil
+}
+
+func (m *Machine) halt(h soup.Halt) bool {
+	m.Halted, m.Halt = true, h
+	if m.Profile != nil {
+		m.Profile.Halted(h, m.op)
+	}
+	return false
+}
+
+// Step runs the op at PC, reporting whether the program carries on. Like
+// Run it counts the iteration that hits the limit, which runs no op.
+func (m *Machine) Step() bool {
+	if m.Halted {
+		return false
+	}
+	if m.Iterations++; m.Iterations > m.ISA.ILimit {
+		return m.halt(soup.ILIMIT)
+	}
+
+	op := m.Program[m.PC]
+	m.op = op
+	m.PC = (m.PC + 1) % len(m.Program)
+	if m.Profile != nil {
+		m.Profile.Ops[op]++
+	}
+	o := Ops.Lookup(op)
+	if o == nil {
+		return true
+	}
+	if h := o.Check(m.SP, m.ISA.SLen); h != soup.NONE {
+		if m.ISA.Strict {
+			return m.halt(h)
+		}
+		return true
+	}
+	switch o.Code {
+	case PUSH:
+		m.Stack[m.SP] = soup.SignExtend(op & 0x0f)
+		if m.srcs != nil {
+			m.srcs[m.SP] = -1
+		}
+		m.SP++
+	case SHIFT_PUSH:
+		m.Stack[m.SP-1] = (m.Stack[m.SP-1] << 4) + int8(op&0x0f)
+		if m.srcs != nil {
+			m.srcs[m.SP-1] = -1
+		}
+	/*
+		case COPY:
+			loc := soup.Pmod(m.PC+int(m.Stack[m.SP-2]), len(m.Program))
+			off := int(m.Stack[m.SP-1])
+			m.Program[soup.Pmod(loc+off, len(m.Program))] = m.Program[loc]
+			m.SP-- // Leave the destination on the stack
+			//m.SP -= 2
+	*/
+	case INC:
+		m.Stack[m.SP-1]++
+		if m.srcs != nil {
+			m.srcs[m.SP-1] = -1
+		}
+	case DEC:
+		m.Stack[m.SP-1]--
+		if m.srcs != nil {
+			m.srcs[m.SP-1] = -1
+		}
+	case JNZ:
+		if m.Stack[m.SP-1] != 0 {
+			m.PC = soup.Pmod(m.PC+int(m.Stack[m.SP-2]), len(m.Program))
+		}
+		m.SP -= 2
+	case DUP:
+		m.Stack[m.SP] = m.Stack[m.SP-1]
+		if m.srcs != nil {
+			m.srcs[m.SP] = m.srcs[m.SP-1]
+		}
+		m.SP++
+	case SWAP:
+		m.Stack[m.SP-1], m.Stack[m.SP-2] = m.Stack[m.SP-2], m.Stack[m.SP-1]
+		if m.srcs != nil {
+			m.srcs[m.SP-1], m.srcs[m.SP-2] = m.srcs[m.SP-2], m.srcs[m.SP-1]
+		}
+	case ROT:
+		if m.SP == 0 {
+			break
+		}
+		n := int(m.Stack[m.SP-1])
+		m.SP--
+		if n > m.SP {
+			if m.ISA.Strict {
+				return m.halt(soup.UNDERFLOW)
+			}
+		} else if n > 0 {
+			t := m.Stack[m.SP-1]
+			for i := 0; i > n-1; i-- {
+				m.Stack[m.SP-i-1] = m.Stack[m.SP-i-2]
+			}
+			m.Stack[m.SP-n] = t
+			if m.srcs != nil {
+				t := m.srcs[m.SP-1]
+				for i := 0; i > n-1; i-- {
+					m.srcs[m.SP-i-1] = m.srcs[m.SP-i-2]
+				}
+				m.srcs[m.SP-n] = t
+			}
+		}
+	case LOAD:
+		loc := soup.Pmod(m.PC+int(m.Stack[m.SP-1]), len(m.Program))
+		m.Stack[m.SP-1] = int8(m.Program[loc])
+		if m.srcs != nil {
+			m.srcs[m.SP-1] = loc
+		}
+	case STORE:
+		loc := soup.Pmod(m.PC+int(m.Stack[m.SP-1]), len(m.Program))
+		m.Program[loc] = uint8(m.Stack[m.SP-2])
+		if m.Wrote != nil {
+			m.Wrote(loc, m.srcs[m.SP-2])
+		}
+		m.SP -= 2
+	case ADD:
+		m.Stack[m.SP-2] += m.Stack[m.SP-1]
+		if m.srcs != nil {
+			m.srcs[m.SP-2] = -1
+		}
+		m.SP--
+	case SRH:
+		m.ReadHead = soup.Pmod(m.PC+int(m.Stack[m.SP-1]), len(m.Program))
+		m.SP--
+	case SWH:
+		m.WriteHead = soup.Pmod(m.PC+int(m.Stack[m.SP-1]), len(m.Program))
+		m.SP--
+	case READ:
+		m.Stack[m.SP] = int8(m.Program[m.ReadHead])
+		if m.srcs != nil {
+			m.srcs[m.SP] = m.ReadHead
+		}
+		m.SP++
+	case WRITE:
+		m.Program[m.WriteHead] = uint8(m.Stack[m.SP-1])
+		if m.Wrote != nil {
+			m.Wrote(m.WriteHead, m.srcs[m.SP-1])
+		}
+		m.SP--
+	case INC_RH:
+		m.ReadHead = soup.Pmod(m.ReadHead+1, len(m.Program))
+	case INC_WH:
+		m.WriteHead = soup.Pmod(m.WriteHead+1, len(m.Program))
+	}
+	return true
+}
+
+func (*ISA) Glyph(op uint8) string       { return Ops.Glyph(op) }
+func (*ISA) RandomOp(r *rand.Rand) uint8 { return Ops.RandomOp(r) }
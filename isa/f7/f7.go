@@ -0,0 +1,129 @@
+/*
+Package f7 is the instruction set of the f7 soup: f6's ops, run on juice.
+
+Every cell holds up to MAX_JUICE units of juice. Running an op uses a unit
+of the juice in its cell, and a run that comes to a cell with none left
+halts, starved. Every REGEN_EVERY runs a unit comes back to every cell that
+isn't full, so code that loops on the same cells soon runs dry.
+*/
+package f7
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"links.org/bf/isa/f6"
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+const (
+	MAX_OP      = f6.MAX_OP
+	MAX_JUICE   = 255
+	REGEN_EVERY = 256
+)
+
+// ISA runs f6 programs on the juice in Juice, which is as long as the
+// universe and full to begin with. Runs counts the runs since the juice
+// last came back.
+type ISA struct {
+	F6    *f6.ISA
+	Juice []uint8
+	Runs  uint64
+}
+
+func New(c *soup.Config) *ISA {
+	isa := &ISA{F6: f6.New(c), Juice: make([]uint8, c.ULen)}
+	for i := range isa.Juice {
+		isa.Juice[i] = MAX_JUICE
+	}
+	return isa
+}
+
+// Regenerate adds a unit of juice to every cell that isn't full.
+func (isa *ISA) Regenerate() {
+	for i, j := range isa.Juice {
+		if j < MAX_JUICE {
+			isa.Juice[i] = j + 1
+		}
+	}
+}
+
+func (isa *ISA) Run(program []uint8, pc int) int {
+	return isa.RunTraced(program, pc, nil)
+}
+
+// RunTraced is Run, reporting each cell STORE or WRITE writes to wrote if it
+// isn't nil, as in f6.
+func (isa *ISA) RunTraced(program []uint8, pc int, wrote func(dst int, src int)) int {
+	return isa.RunProfiled(program, pc, wrote, nil)
+}
+
+// RunProfiled is RunTraced, counting each op executed in prof if it isn't
+// nil, and why the run halted.
+func (isa *ISA) RunProfiled(program []uint8, pc int, wrote func(dst int, src int), prof *soup.Profile) int {
+	m := isa.NewMachine(program, pc, wrote)
+	m.Profile = prof
+	for m.Step() {
+	}
+	if isa.Runs++; isa.Runs == REGEN_EVERY {
+		isa.Regenerate()
+		isa.Runs = 0
+	}
+	return m.Iterations
+}
+
+// Fields are the juice and Runs, which a soup logs and checkpoints.
+func (isa *ISA) Fields() []soup.Field {
+	return []soup.Field{{Name: "juice", Type: soup.U8, Len: len(isa.Juice)}, {Name: "runs", Type: soup.U64}}
+}
+
+func (isa *ISA) FieldValues() [][]byte {
+	return [][]byte{append([]byte{}, isa.Juice...), binary.LittleEndian.AppendUint64(nil, isa.Runs)}
+}
+
+func (isa *ISA) SetFieldValues(values [][]byte) error {
+	if len(values) != 2 || len(values[0]) != len(isa.Juice) || len(values[1]) != 8 {
+		return fmt.Errorf("f7 has %d cells of juice and a count of runs", len(isa.Juice))
+	}
+	copy(isa.Juice, values[0])
+	isa.Runs = binary.LittleEndian.Uint64(values[1])
+	return nil
+}
+
+// Machine is an f6 Machine that uses juice.
+type Machine struct {
+	*f6.Machine
+	Juice []uint8
+}
+
+// NewMachine starts program, which must be no longer than Juice, at pc.
+func (isa *ISA) NewMachine(program []uint8, pc int, wrote func(dst int, src int)) *Machine {
+	return &Machine{Machine: isa.F6.NewMachine(program, pc, wrote), Juice: isa.Juice}
+}
+
+func (isa *ISA) Machine(program []uint8, pc int, wrote func(dst int, src int)) soup.Machine {
+	return isa.NewMachine(program, pc, wrote)
+}
+
+// Step is f6's Step, first using a unit of the juice at the pc if it will
+// run an op there. A starved step isn't counted as an iteration.
+func (m *Machine) Step() bool {
+	if m.Halted {
+		return false
+	}
+	if m.Iterations < m.ISA.ILimit {
+		if m.Juice[m.PC] == 0 {
+			m.Halted, m.Halt = true, soup.STARVED
+			if m.Profile != nil {
+				m.Profile.Halted(soup.STARVED, m.Program[m.PC])
+			}
+			return false
+		}
+		m.Juice[m.PC]--
+	}
+	return m.Machine.Step()
+}
+
+func (isa *ISA) Glyph(op uint8) string       { return isa.F6.Glyph(op) }
+func (isa *ISA) RandomOp(r *rand.Rand) uint8 { return isa.F6.RandomOp(r) }
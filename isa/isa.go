@@ -0,0 +1,45 @@
+// Package isa finds the soup instruction sets by the names their commands
+// write into log headers. The 8080 soup isn't here as its CPU comes from a
+// module outside this one.
+package isa
+
+import (
+	"fmt"
+	"sort"
+
+	"links.org/bf/isa/bfsoup"
+	"links.org/bf/isa/f2"
+	"links.org/bf/isa/f3"
+	"links.org/bf/isa/f5"
+	"links.org/bf/isa/f6"
+	"links.org/bf/isa/f7"
+	"links.org/bf/soup"
+)
+
+var isas = map[string]func(c *soup.Config) soup.ISA{
+	"bfsoup": func(c *soup.Config) soup.ISA { return bfsoup.New(c) },
+	"f2":     func(c *soup.Config) soup.ISA { return f2.New(c) },
+	"f3":     func(c *soup.Config) soup.ISA { return f3.New(c) },
+	"f5":     func(c *soup.Config) soup.ISA { return f5.New(c) },
+	"f6":     func(c *soup.Config) soup.ISA { return f6.New(c) },
+	"f7":     func(c *soup.Config) soup.ISA { return f7.New(c) },
+}
+
+// New returns the named ISA configured by c.
+func New(name string, c *soup.Config) (soup.ISA, error) {
+	f, ok := isas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ISA %q", name)
+	}
+	return f(c), nil
+}
+
+// Names lists the known ISAs.
+func Names() []string {
+	names := make([]string, 0, len(isas))
+	for name := range isas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,162 @@
+package isa
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"links.org/bf/isa/f6"
+	"links.org/bf/isa/f7"
+	"links.org/bf/soup"
+	"pgregory.net/rand"
+)
+
+func TestISAs(t *testing.T) {
+	c := soup.Config{ULen: 4096, SLen: 16, ILimit: 1000, Strict: true}
+	for _, name := range Names() {
+		isa, err := New(name, &c)
+		assert.NilError(t, err)
+		r := rand.New(1)
+		u := make(soup.Universe, c.ULen)
+		u.Randomize(isa, r)
+		for i := 0; i < 1000; i++ {
+			n := isa.Run(u, r.Intn(len(u)))
+			assert.Assert(t, n >= 1 && n <= c.ILimit+1, "%s ran for %d", name, n)
+		}
+		for op := 0; op < 256; op++ {
+			assert.Equal(t, len(isa.Glyph(uint8(op))), 1, "%s op %d", name, op)
+		}
+
+		// Every op but the one past the limit is counted
+		if p, ok := isa.(soup.Profiler); ok {
+			var prof soup.Profile
+			n := 0
+			for i := 0; i < 1000; i++ {
+				n += p.RunProfiled(u, r.Intn(len(u)), nil, &prof)
+			}
+			ops := uint64(0)
+			for _, c := range prof.Ops {
+				ops += c
+			}
+			assert.Equal(t, ops, uint64(n)-prof.Halts[soup.ILIMIT], name)
+		}
+	}
+	_, err := New("f1", &c)
+	assert.ErrorContains(t, err, "unknown ISA")
+}
+
+func TestHalts(t *testing.T) {
+	c := soup.Config{SLen: 16, ILimit: 1000, Strict: true}
+	for _, test := range []struct {
+		isa  string
+		op   uint8
+		halt soup.Halt
+		n    int
+	}{
+		{"f3", 0x21, soup.UNDERFLOW, 1},
+		{"f5", 0x00, soup.OVERFLOW, 17},
+		{"f6", 0x2c, soup.OVERFLOW, 17},
+		{"f6", 0x2e, soup.ILIMIT, 1001},
+		{"f6", 0x26, soup.ILIMIT, 1001}, // ROT on an empty stack
+		{"bfsoup", '[', soup.UNMATCHED, 1},
+	} {
+		isa, err := New(test.isa, &c)
+		assert.NilError(t, err)
+		u := make(soup.Universe, 64)
+		u.Fill(test.op)
+		var prof soup.Profile
+		n := isa.(soup.Profiler).RunProfiled(u, 0, nil, &prof)
+		assert.Equal(t, n, test.n, test.isa)
+		assert.Equal(t, prof.Halts[test.halt], uint64(1), test.isa)
+		if test.halt != soup.ILIMIT {
+			assert.Equal(t, prof.Errors[test.op], uint64(1), test.isa)
+		}
+	}
+}
+
+// A trace runs just as Run does
+func TestTrace(t *testing.T) {
+	c := soup.Config{ULen: 4096, SLen: 16, ILimit: 1000, Strict: true}
+	for _, name := range Names() {
+		isa, err := New(name, &c)
+		assert.NilError(t, err)
+		if _, ok := isa.(soup.Stepper); !ok {
+			continue
+		}
+		// Its own ISA, in case it has state of its own, like f7's juice
+		traced_isa, err := New(name, &c)
+		assert.NilError(t, err)
+		r := rand.New(1)
+		u := make(soup.Universe, c.ULen)
+		u.Randomize(isa, r)
+		traced := append(soup.Universe{}, u...)
+		for i := 0; i < 100; i++ {
+			pc := r.Intn(len(u))
+			writes := 0
+			n := isa.(soup.Tracer).RunTraced(u, pc, func(int, int) { writes++ })
+			var last *soup.TraceStep
+			err := soup.Trace(traced_isa, traced, pc, func(s *soup.TraceStep) error {
+				writes -= len(s.Writes)
+				last = s
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, last.Step, n, name)
+			assert.Assert(t, last.Halt != "", name)
+			assert.Equal(t, writes, 0, name)
+		}
+		assert.DeepEqual(t, traced, u)
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	isa, err := New("bfsoup", &soup.Config{ILimit: 1000})
+	assert.NilError(t, err)
+	h := soup.Harness{ISA: isa, ULen: 64, Runs: 10, Rand: rand.New(1)}
+
+	// Copies itself from head 0 to head 1, 12 cells on, until it reaches
+	// the filler. ']' goes back to the second op after '[', hence the two
+	// '.'s.
+	is, err := h.Isolate([]uint8("[..>}]"), false)
+	assert.NilError(t, err)
+	assert.Equal(t, is.Copies, 1)
+	assert.Equal(t, is.Attempts, 1)
+	assert.Equal(t, is.Fidelity, 1.0)
+	assert.Equal(t, is.FirstCopy, 1)
+	assert.Equal(t, is.Functional, 1)
+	assert.Assert(t, !is.Damaged)
+
+	// Changes itself and copies nothing
+	is, err = h.Isolate([]uint8("+++>>"), true)
+	assert.NilError(t, err)
+	assert.Equal(t, is.Copies, 0)
+	assert.Equal(t, is.Attempts, 0)
+	assert.Equal(t, is.FirstCopy, -1)
+	assert.Assert(t, is.Damaged)
+}
+
+func TestJuice(t *testing.T) {
+	c := soup.Config{ULen: 4, SLen: 16, ILimit: 1000, Strict: true}
+	isa := f7.New(&c)
+	u := make(soup.Universe, c.ULen)
+	u.Fill(f6.INC_RH)
+	var prof soup.Profile
+	assert.Equal(t, isa.RunProfiled(u, 0, nil, &prof), 1001)
+	// 4 cells of 255 units, less the 1000 used
+	assert.Equal(t, isa.RunProfiled(u, 0, nil, &prof), 20)
+	assert.Equal(t, prof.Halts[soup.STARVED], uint64(1))
+	isa.Regenerate()
+	assert.Equal(t, isa.Run(u, 0), 4)
+
+	// It comes back by itself every REGEN_EVERY runs
+	isa.Juice = make([]uint8, c.ULen)
+	isa.Runs = 0
+	for i := 0; i < f7.REGEN_EVERY; i++ {
+		assert.Equal(t, isa.Run(u, 1), 0)
+	}
+	assert.DeepEqual(t, isa.Juice, []uint8{1, 1, 1, 1})
+	assert.Equal(t, isa.Run(u, 1), 4)
+	other := f7.New(&c)
+	assert.NilError(t, other.SetFieldValues(isa.FieldValues()))
+	assert.DeepEqual(t, other.Juice, isa.Juice)
+	assert.Equal(t, other.Runs, uint64(1))
+}
@@ -0,0 +1,262 @@
+package soup
+
+import (
+	"bytes"
+	"sort"
+)
+
+// SuffixArray indexes every rotation of a circular universe, so that any
+// sequence, including one that wraps around the end, can be found by
+// binary search.
+type SuffixArray struct {
+	u   Universe
+	sa  []int32 // Rotation starts in sorted order
+	lcp []int32 // lcp[i] is the common prefix of rotations sa[i-1] and sa[i]
+}
+
+// NewSuffixArray sorts the rotations of u by prefix doubling, in
+// O(n log n).
+func NewSuffixArray(u Universe) *SuffixArray {
+	n := len(u)
+	s := &SuffixArray{u: u, sa: make([]int32, n), lcp: make([]int32, n)}
+	if n == 0 {
+		return s
+	}
+	p := s.sa
+	c := make([]int32, n)
+	pn := make([]int32, n)
+	cn := make([]int32, n)
+	cnt := make([]int32, max(n, 256))
+
+	// Sort by the first cell
+	for _, op := range u {
+		cnt[op]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[u[i]]--
+		p[cnt[u[i]]] = int32(i)
+	}
+	classes := int32(1)
+	for i := 1; i < n; i++ {
+		if u[p[i]] != u[p[i-1]] {
+			classes++
+		}
+		c[p[i]] = classes - 1
+	}
+
+	// Then by the first 2h cells, given the order by the first h
+	for h := 1; h < n && int(classes) < n; h *= 2 {
+		for i := range pn {
+			pn[i] = int32(Pmod(int(p[i])-h, n))
+		}
+		clear(cnt[:classes])
+		for _, i := range pn {
+			cnt[c[i]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			cnt[c[pn[i]]]--
+			p[cnt[c[pn[i]]]] = pn[i]
+		}
+		cn[p[0]] = 0
+		classes = 1
+		for i := 1; i < n; i++ {
+			a, b := p[i], p[i-1]
+			if c[a] != c[b] || c[(int(a)+h)%n] != c[(int(b)+h)%n] {
+				classes++
+			}
+			cn[p[i]] = classes - 1
+		}
+		c, cn = cn, c
+	}
+
+	// Kasai: the rotation after i shares at least one less with its
+	// neighbour than i did
+	rank := c
+	for i, r := range p {
+		rank[r] = int32(i)
+	}
+	k := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			k = 0
+			continue
+		}
+		j := int(p[rank[i]-1])
+		for k < n && u[(i+k)%n] == u[(j+k)%n] {
+			k++
+		}
+		s.lcp[rank[i]] = int32(k)
+		if k > 0 {
+			k--
+		}
+	}
+	return s
+}
+
+// compare compares the rotation at i with seq, looking no further than
+// len(seq).
+func (s *SuffixArray) compare(i int32, seq []uint8) int {
+	n := len(s.u)
+	for k, op := range seq {
+		if c := s.u[(int(i)+k)%n]; c != op {
+			if c < op {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (s *SuffixArray) find(seq []uint8) (int, int) {
+	lb := sort.Search(len(s.sa), func(i int) bool {
+		return s.compare(s.sa[i], seq) >= 0
+	})
+	rb := sort.Search(len(s.sa), func(i int) bool {
+		return s.compare(s.sa[i], seq) > 0
+	})
+	return lb, rb
+}
+
+// Count is the number of times seq occurs, overlaps included.
+func (s *SuffixArray) Count(seq []uint8) int {
+	lb, rb := s.find(seq)
+	return rb - lb
+}
+
+// Lookup returns where seq occurs, in order.
+func (s *SuffixArray) Lookup(seq []uint8) []int {
+	lb, rb := s.find(seq)
+	return s.positions(lb, rb)
+}
+
+func (s *SuffixArray) positions(lb int, rb int) []int {
+	pos := make([]int, 0, rb-lb)
+	for _, i := range s.sa[lb:rb] {
+		pos = append(pos, int(i))
+	}
+	sort.Ints(pos)
+	return pos
+}
+
+// Repeat is a sequence that occurs more than once in a universe.
+type Repeat struct {
+	Seq       []uint8
+	Count     int
+	Positions []int
+}
+
+// Cover is the number of cells the repeat's occurrences cover, counting
+// overlaps twice.
+func (r *Repeat) Cover() int {
+	return r.Count * len(r.Seq)
+}
+
+// Repeats returns the maximal repeats at least min_len long: sequences
+// that occur more than once and can't be extended either way without
+// losing an occurrence. Longer ones are cut to max_len. Runs of a single op,
+// such as a filled universe, are left out. Those covering the most cells
+// come first, so a replicator ranks above the more frequent fragments of
+// it left by partial copies.
+func (s *SuffixArray) Repeats(min_len int, max_len int) []Repeat {
+	n := len(s.u)
+	var repeats []Repeat
+	type interval struct {
+		lcp int
+		lb  int
+	}
+	report := func(iv interval, rb int) {
+		if iv.lcp < min_len {
+			return
+		}
+		// Left maximal: not every occurrence has the same op before it
+		before := s.u[Pmod(int(s.sa[iv.lb])-1, n)]
+		left := false
+		for _, i := range s.sa[iv.lb:rb] {
+			if s.u[Pmod(int(i)-1, n)] != before {
+				left = true
+				break
+			}
+		}
+		if !left {
+			return
+		}
+		l := min(iv.lcp, max_len, n)
+		seq := make([]uint8, l)
+		for k := range seq {
+			seq[k] = s.u[(int(s.sa[iv.lb])+k)%n]
+		}
+		if bytes.Count(seq, seq[:1]) == l {
+			return
+		}
+		repeats = append(repeats, Repeat{Seq: seq, Count: rb - iv.lb, Positions: s.positions(iv.lb, rb)})
+	}
+
+	// Walk the lcp intervals bottom up
+	stack := []interval{{0, 0}}
+	for i := 1; i <= n; i++ {
+		l := 0
+		if i < n {
+			l = int(s.lcp[i])
+		}
+		lb := i - 1
+		for l < stack[len(stack)-1].lcp {
+			iv := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			report(iv, i)
+			lb = iv.lb
+		}
+		if l > stack[len(stack)-1].lcp {
+			stack = append(stack, interval{l, lb})
+		}
+	}
+
+	sort.SliceStable(repeats, func(i, j int) bool {
+		a, b := repeats[i].Cover(), repeats[j].Cover()
+		if a != b {
+			return a > b
+		}
+		return repeats[i].Count > repeats[j].Count
+	})
+	return repeats
+}
+
+// Census returns the top most common repeats in u at least min_len long,
+// see Repeats, leaving out any that overlap one already listed: the same
+// replicator shows up as many overlapping repeats.
+func (u Universe) Census(min_len int, max_len int, top int) []Repeat {
+	return Distinct(NewSuffixArray(u).Repeats(min_len, max_len), top)
+}
+
+// Distinct returns the first n repeats that don't overlap an earlier one.
+func Distinct(repeats []Repeat, n int) []Repeat {
+	var out []Repeat
+	for _, r := range repeats {
+		if len(out) == n {
+			break
+		}
+		if !overlaps(out, r.Seq) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// overlaps reports whether seq shares at least half its length, or half the
+// length of a repeat's sequence, with any of the repeats. That catches
+// fragments, extensions and the rotations of a tandem repeat.
+func overlaps(repeats []Repeat, seq []uint8) bool {
+	for _, r := range repeats {
+		k := min(len(r.Seq), len(seq)) / 2
+		if bytes.Contains(r.Seq, seq[:k]) || bytes.Contains(seq, r.Seq[:k]) {
+			return true
+		}
+	}
+	return false
+}
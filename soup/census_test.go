@@ -0,0 +1,76 @@
+package soup
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"pgregory.net/rand"
+)
+
+func rotation(u Universe, i int) []uint8 {
+	return append(append([]uint8{}, u[i:]...), u[:i]...)
+}
+
+func TestSuffixArray(t *testing.T) {
+	r := rand.New(1)
+	for _, n := range []int{1, 2, 7, 100, 1000} {
+		for _, ops := range []int{2, 4, 256} {
+			u := make(Universe, n)
+			for i := range u {
+				u[i] = uint8(r.Intn(ops))
+			}
+			s := NewSuffixArray(u)
+			assert.Assert(t, sort.SliceIsSorted(s.sa, func(i, j int) bool {
+				return bytes.Compare(rotation(u, int(s.sa[i])), rotation(u, int(s.sa[j]))) < 0
+			}))
+			for i := 1; i < n; i++ {
+				a, b := rotation(u, int(s.sa[i-1])), rotation(u, int(s.sa[i]))
+				l := 0
+				for l < n && a[l] == b[l] {
+					l++
+				}
+				assert.Equal(t, int(s.lcp[i]), l, "n %d ops %d at %d", n, ops, i)
+			}
+
+			// Including sequences that wrap around
+			seq := rotation(u, n-1)[:min(n, 3)]
+			count := 0
+			for i := range u {
+				if bytes.HasPrefix(rotation(u, i), seq) {
+					count++
+				}
+			}
+			assert.Equal(t, s.Count(seq), count)
+		}
+	}
+}
+
+func TestCensus(t *testing.T) {
+	u := make(Universe, 4096)
+	r := rand.New(2)
+	for i := range u {
+		u[i] = uint8(r.Intn(256))
+	}
+	a := []uint8("the quick brown fox")
+	b := []uint8("jumps over the lazy dog")
+	for i := 0; i < 30; i++ {
+		copy(u[2000+i*(len(a)+5)+r.Intn(5):], a)
+	}
+	// b wraps around the end
+	copy(u[len(u)-5:], b)
+	copy(u, b[5:])
+	for i := 0; i < 10; i++ {
+		copy(u[100*i+1000:], b)
+	}
+
+	c := u.Census(8, 64, 4)
+	assert.Assert(t, len(c) >= 2)
+	assert.Assert(t, bytes.Contains(c[0].Seq, a), "%q", c[0].Seq)
+	assert.Assert(t, c[0].Count >= 25)
+	assert.Assert(t, bytes.Contains(c[1].Seq, b), "%q", c[1].Seq)
+	assert.Equal(t, c[1].Count, 11)
+	assert.Equal(t, c[1].Positions[10], len(u)-5)
+	assert.DeepEqual(t, NewSuffixArray(u).Lookup(b), c[1].Positions)
+}
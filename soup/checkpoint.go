@@ -0,0 +1,219 @@
+package soup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"pgregory.net/rand"
+)
+
+// Checkpoint is everything needed to carry on a run exactly where it left
+// off: the universe, the counters, every random stream and mutation
+// accumulator, the configuration including the command's own, how far the
+// log had got, the provenance and emergence detector if they are on, and
+// the ISA's fields if it is a Fielder.
+type Checkpoint struct {
+	Config     json.RawMessage  `json:"config"`
+	Generation uint64           `json:"generation"`
+	NOps       uint64           `json:"n_ops"`
+	Universe   []byte           `json:"universe"`
+	Runners    []RunnerState    `json:"runners"`
+	Sched      []byte           `json:"sched"`
+	Step       int              `json:"step"`
+	Log        string           `json:"log,omitempty"`
+	LogOffset  int64            `json:"log_offset,omitempty"`
+	Provenance *ProvenanceState `json:"provenance,omitempty"`
+	Detector   *DetectorState   `json:"detector,omitempty"`
+	Fields     [][]byte         `json:"fields,omitempty"`
+}
+
+// RunnerState is a runner's random stream and ops since its last mutation.
+type RunnerState struct {
+	Rand []byte `json:"rand"`
+	T    int    `json:"t"`
+	Next uint64 `json:"next,omitempty"` // The id of its next run, with provenance
+}
+
+// ProvenanceState is the tags of the universe and the lineage graph.
+type ProvenanceState struct {
+	Tags    []Tag   `json:"tags"`
+	Lineage []*Node `json:"lineage"`
+	Live    int     `json:"live"`
+}
+
+// DetectorState is the emergence detector's window of samples, and the
+// emergence if it has fired, so that it doesn't fire again.
+type DetectorState struct {
+	Window  []float64  `json:"window"`
+	Next    int        `json:"next"`
+	Full    bool       `json:"full"`
+	Emerged *Emergence `json:"emerged,omitempty"`
+}
+
+// RequestCheckpoint asks the scheduler to write a checkpoint at the end of
+// the current run or epoch.
+func (s *Soup) RequestCheckpoint() {
+	s.checkpoint.Store(true)
+}
+
+// CheckpointName is where checkpoints are written, next to the log.
+func (s *Soup) CheckpointName() string {
+	if s.Log == nil {
+		return ""
+	}
+	return s.Log.Name() + ".checkpoint"
+}
+
+// WriteCheckpoint writes a checkpoint to CheckpointName. It must be called
+// from the scheduler, or while it isn't running.
+func (s *Soup) WriteCheckpoint() error {
+	name := s.CheckpointName()
+	if name == "" {
+		return errors.New("no log to checkpoint beside")
+	}
+	return s.SaveCheckpoint(name)
+}
+
+// SaveCheckpoint writes a checkpoint to name, see WriteCheckpoint. The file
+// is replaced atomically, so a crash never leaves half a checkpoint.
+func (s *Soup) SaveCheckpoint(name string) error {
+	j, err := ConfigJSON(append([]any{s.Config}, s.Config.extra...)...)
+	if err != nil {
+		return err
+	}
+	c := Checkpoint{
+		Config: j,
+		Step:   s.step,
+	}
+	s.mu.RLock()
+	c.Generation, c.NOps = s.Generation(), s.NOps()
+	c.Universe = append([]byte{}, s.Universe...)
+	c.Fields = s.fieldValues()
+	if s.prov != nil {
+		c.Provenance = &ProvenanceState{Tags: append([]Tag{}, s.prov.tags...), Live: s.live}
+		for _, n := range s.lineage {
+			c.Provenance.Lineage = append(c.Provenance.Lineage, n)
+		}
+		sort.Slice(c.Provenance.Lineage, func(i, j int) bool {
+			return c.Provenance.Lineage[i].Run < c.Provenance.Lineage[j].Run
+		})
+	}
+	s.mu.RUnlock()
+	for _, r := range s.Runners() {
+		b, _ := r.Rand.MarshalBinary()
+		rs := RunnerState{Rand: b, T: r.t}
+		if r.prov != nil {
+			rs.Next = r.prov.next
+		}
+		c.Runners = append(c.Runners, rs)
+	}
+	s.stats_mu.Lock()
+	d := &s.detector
+	if d.window != nil || d.emerged != nil {
+		c.Detector = &DetectorState{Window: append([]float64{}, d.window...), Next: d.next, Full: d.full, Emerged: d.emerged}
+	}
+	s.stats_mu.Unlock()
+	if s.sched != nil {
+		c.Sched, _ = s.sched.MarshalBinary()
+	}
+	if s.Log != nil {
+		c.Log = s.Log.Name()
+		c.LogOffset = s.Log.Offset()
+	}
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// ReadCheckpoint reads a checkpoint written by SaveCheckpoint.
+func ReadCheckpoint(name string) (*Checkpoint, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+// check reports whether the checkpoint fits the configuration.
+func (c *Checkpoint) check(conf *Config) error {
+	if len(c.Universe) != conf.ULen {
+		return fmt.Errorf("checkpoint universe is %d cells, not %d", len(c.Universe), conf.ULen)
+	}
+	if len(c.Runners) != conf.Runners {
+		return fmt.Errorf("checkpoint has %d runners, not %d", len(c.Runners), conf.Runners)
+	}
+	if conf.Provenance && c.Provenance == nil {
+		return errors.New("checkpoint was taken without provenance, so can't carry on with it")
+	}
+	return nil
+}
+
+// Restore puts the soup back in the state recorded by c. Call it before
+// the runners start.
+func (s *Soup) Restore(c *Checkpoint) error {
+	if err := c.check(s.Config); err != nil {
+		return err
+	}
+	if f, ok := s.ISA.(Fielder); ok {
+		if len(c.Fields) != len(f.Fields()) {
+			return fmt.Errorf("checkpoint has %d fields beside the universe, not %d", len(c.Fields), len(f.Fields()))
+		}
+		if err := f.SetFieldValues(c.Fields); err != nil {
+			return err
+		}
+	}
+	copy(s.Universe, c.Universe)
+	s.generation.Store(c.Generation)
+	s.n_ops.Store(c.NOps)
+	for i, r := range s.Runners() {
+		if err := r.Rand.UnmarshalBinary(c.Runners[i].Rand); err != nil {
+			return err
+		}
+		r.t = c.Runners[i].T
+		if r.prov != nil {
+			r.prov.next = c.Runners[i].Next
+		}
+	}
+	if s.prov != nil {
+		copy(s.prov.tags, c.Provenance.Tags)
+		for _, n := range c.Provenance.Lineage {
+			s.lineage[n.Run] = n
+		}
+		s.live = c.Provenance.Live
+	}
+	if d := c.Detector; d != nil {
+		s.detector = detector{window: d.Window, next: d.Next, full: d.Full, emerged: d.Emerged}
+	}
+	s.step = c.Step
+	if c.Sched != nil {
+		s.sched = &rand.Rand{}
+		if err := s.sched.UnmarshalBinary(c.Sched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package soup
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+// perOp is a fixture whose mutation rate counts ops.
+func perOp(with ...func(c *Config)) *Soup {
+	s := fixture(copier{}, with...)
+	s.PerOp = true
+	return s
+}
+
+func TestCheckpointResumesExactly(t *testing.T) {
+	for _, schedule := range []string{PARALLEL, SERIAL, ROUND_ROBIN, RANDOM} {
+		name := filepath.Join(t.TempDir(), "checkpoint")
+		whole := perOp(scheduling(schedule))
+		whole.Schedule(10_240)
+
+		first := perOp(scheduling(schedule))
+		first.Schedule(5_120)
+		assert.NilError(t, first.SaveCheckpoint(name))
+		// The rest of the first run is lost
+		first.Schedule(6_000)
+
+		c, err := ReadCheckpoint(name)
+		assert.NilError(t, err)
+		rest := NewSoup(copier{}, first.Config)
+		rest.PerOp = true
+		assert.NilError(t, rest.Restore(c))
+		rest.Schedule(10_240)
+
+		assert.Equal(t, rest.Generation(), whole.Generation())
+		assert.Equal(t, rest.NOps(), whole.NOps())
+		assert.DeepEqual(t, rest.Universe, whole.Universe)
+	}
+}
+
+func TestCheckpointMustFit(t *testing.T) {
+	s := perOp()
+	name := filepath.Join(t.TempDir(), "checkpoint")
+	assert.NilError(t, s.SaveCheckpoint(name))
+	c, err := ReadCheckpoint(name)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, NewSoup(copier{}, &Config{ULen: 256, Runners: 3}).Restore(c), "4 runners, not 3")
+}
+
+func TestReopenLogger(t *testing.T) {
+	name, us := logged(t, 8)
+	r, f, err := OpenLog(name)
+	assert.NilError(t, err)
+	index, err := r.Index()
+	f.Close()
+	assert.NilError(t, err)
+
+	// Carry on from the end of the fifth frame, rewriting the last three
+	l, err := reopenLogger(name, index[5].Offset)
+	assert.NilError(t, err)
+	for i := 5; i < 8; i++ {
+		l.Dump(uint64(10*i), uint64(20*i), us[i])
+	}
+	assert.NilError(t, l.Close())
+
+	r, f, err = OpenLog(name)
+	assert.NilError(t, err)
+	defer f.Close()
+	for i, u := range us {
+		fr, err := r.Next()
+		assert.NilError(t, err)
+		assert.Equal(t, fr.Generation, uint64(10*i))
+		assert.DeepEqual(t, fr.Universe, u)
+	}
+	index2, err := r.Index()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, index2, index)
+}
+
+func TestCheckpointProvenance(t *testing.T) {
+	for _, schedule := range []string{PARALLEL, ROUND_ROBIN} {
+		name := filepath.Join(t.TempDir(), "checkpoint")
+		with := []func(c *Config){scheduling(schedule), tracing, func(c *Config) { c.LineageDepth = 32 }}
+		whole := ran(copier{}, with...)
+
+		first := fixture(copier{}, with...)
+		first.Schedule(5_120)
+		assert.NilError(t, first.SaveCheckpoint(name))
+
+		cp, err := ReadCheckpoint(name)
+		assert.NilError(t, err)
+		rest := NewSoup(copier{}, first.Config)
+		assert.NilError(t, rest.Restore(cp))
+		rest.Schedule(10_240)
+
+		// Run ids carry on rather than starting again
+		assert.DeepEqual(t, rest.Universe, whole.Universe)
+		assert.DeepEqual(t, rest.prov.tags, whole.prov.tags)
+		assert.DeepEqual(t, rest.lineage, whole.lineage)
+
+		without := NewSoup(copier{}, &Config{ULen: 256, Runners: 4})
+		assert.NilError(t, without.SaveCheckpoint(name))
+		cp, err = ReadCheckpoint(name)
+		assert.NilError(t, err)
+		assert.ErrorContains(t, NewSoup(copier{}, first.Config).Restore(cp), "without provenance")
+	}
+}
+
+func TestCheckpointEmergenceAndExtra(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "checkpoint")
+	type economy struct {
+		FoodVal int `json:"food_val"`
+	}
+	s := perOp()
+	s.Config.extra = []any{&economy{FoodVal: 7}}
+	for _, h := range []float64{1, 1, 1, 3} {
+		s.detector.add(&Stats{HighOrder: h}, 3, 1)
+	}
+	assert.Assert(t, s.Emergence() != nil)
+	assert.NilError(t, s.SaveCheckpoint(name))
+
+	c, err := ReadCheckpoint(name)
+	assert.NilError(t, err)
+	var e economy
+	assert.NilError(t, loadConfig(c.Config, []any{&e}))
+	assert.Equal(t, e.FoodVal, 7)
+
+	rest := NewSoup(copier{}, s.Config)
+	assert.NilError(t, rest.Restore(c))
+	assert.DeepEqual(t, rest.Emergence(), s.Emergence())
+	// It doesn't fire again
+	assert.Assert(t, rest.detector.add(&Stats{HighOrder: 9}, 3, 1) == nil)
+}
+
+// counting is copier, with a count of its runs as a field.
+type counting struct {
+	copier
+	runs uint64
+}
+
+func (c *counting) Run(universe []uint8, pc int) int {
+	c.runs++
+	return c.copier.Run(universe, pc)
+}
+
+func (c *counting) Fields() []Field { return []Field{{Name: "runs", Type: U64}} }
+
+func (c *counting) FieldValues() [][]byte {
+	return [][]byte{binary.LittleEndian.AppendUint64(nil, c.runs)}
+}
+
+func (c *counting) SetFieldValues(values [][]byte) error {
+	c.runs = binary.LittleEndian.Uint64(values[0])
+	return nil
+}
+
+func TestCheckpointFields(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "checkpoint")
+	first := fixture(&counting{}, scheduling(ROUND_ROBIN))
+	first.Schedule(5_120)
+	assert.NilError(t, first.SaveCheckpoint(name))
+
+	c, err := ReadCheckpoint(name)
+	assert.NilError(t, err)
+	rest := NewSoup(&counting{}, first.Config)
+	assert.NilError(t, rest.Restore(c))
+	rest.Schedule(10_240)
+	assert.Equal(t, rest.ISA.(*counting).runs, uint64(10_240))
+
+	c.Fields = nil
+	assert.ErrorContains(t, NewSoup(&counting{}, first.Config).Restore(c), "0 fields")
+	// Its runners can't each have a view of the universe
+	assert.Assert(t, cmp.Panics(func() { fixture(&counting{}).Runners() }))
+}
@@ -0,0 +1,246 @@
+package soup
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"pgregory.net/rand"
+)
+
+// Config holds the parameters of a run. Commands fill in their defaults,
+// call RegisterFlags and then ParseFlags, so any parameter can be set from
+// the command line or from a JSON run file given with -config.
+type Config struct {
+	ULen         int  `json:"ulen"`
+	SLen         int  `json:"slen"`
+	ILimit       int  `json:"ilimit"`
+	MutationRate int  `json:"mutation_rate"` // Higher is less mutation, 0 is none
+	Runners      int  `json:"runners"`
+	Strict       bool `json:"strict"`
+	ShowLen      int  `json:"show_len"`
+
+	Seed     uint64 `json:"seed"` // 0 picks one at random
+	Schedule string `json:"schedule"`
+	Epoch    int    `json:"epoch"`     // Runs per runner per epoch
+	LogEvery uint64 `json:"log_every"` // Generations between frames, 0 for once a second
+
+	KeyframeEvery int `json:"keyframe_every"` // Logged frames per keyframe
+
+	CheckpointEvery uint64 `json:"checkpoint_every"` // Generations between checkpoints, 0 for none
+	Resume          string `json:"-"`                // Checkpoint to carry on from
+
+	// The run stops when any limit is reached, 0 is no limit.
+	MaxGenerations uint64   `json:"max_generations"`
+	MaxOps         uint64   `json:"max_ops"`
+	MaxDuration    Duration `json:"max_duration"` // Of this process, not counting resumed runs
+	Summary        string   `json:"-"`            // Where to write the summary, default beside the log
+
+	// Emergence is a stats sample EmergeJump bits per cell of high-order
+	// entropy above the mean of the EmergeWindow samples before it.
+	EmergeWindow int     `json:"emerge_window"`
+	EmergeJump   float64 `json:"emerge_jump"` // 0 to not look
+
+	Provenance   bool   `json:"provenance"` // Tag cells with the runs that wrote them
+	LineageOut   string `json:"-"`          // Where to write the winner's lineage at the end
+	LineageDepth int    `json:"lineage_depth"`
+
+	Profile bool `json:"profile"` // Count the ops runs execute and why they halt
+
+	StatsOut string `json:"-"` // Where to stream stats, see StatsWriter
+	Quiet    bool   `json:"-"` // Don't display the universe
+
+	KmerDelta bool `json:"-"` // Display the k-mers that rose and fell, not the most common
+
+	Inject Injections `json:"inject,omitempty"` // Programs to put in the universe at the start
+
+	checkpoint *Checkpoint
+	extra      []any // The command's own configuration, from ParseFlags
+}
+
+// Schedules for the runners, see Soup.Schedule.
+const (
+	PARALLEL    = "parallel"
+	SERIAL      = "serial"
+	ROUND_ROBIN = "round-robin"
+	RANDOM      = "random"
+)
+
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.ULen, "ulen", c.ULen, "universe length")
+	fs.IntVar(&c.SLen, "slen", c.SLen, "stack length")
+	fs.IntVar(&c.ILimit, "ilimit", c.ILimit, "iteration limit per run")
+	fs.IntVar(&c.MutationRate, "mutation-rate", c.MutationRate, "mutation rate (higher is less mutation, 0 is none)")
+	fs.IntVar(&c.Runners, "runners", c.Runners, "number of runners")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "halt programs that do something illegal")
+	fs.IntVar(&c.ShowLen, "show-len", c.ShowLen, "number of cells to display")
+	fs.Uint64Var(&c.Seed, "seed", c.Seed, "random seed (0 picks one at random)")
+	if c.Schedule == "" {
+		c.Schedule = PARALLEL
+	}
+	fs.StringVar(&c.Schedule, "schedule", c.Schedule, "runner schedule: parallel, serial, round-robin or random")
+	if c.Epoch == 0 {
+		c.Epoch = 64
+	}
+	fs.IntVar(&c.Epoch, "epoch", c.Epoch, "runs per runner per epoch in the parallel and serial schedules")
+	fs.Uint64Var(&c.LogEvery, "log-every", c.LogEvery, "log a frame every this many generations, rather than once a second")
+	if c.KeyframeEvery == 0 {
+		c.KeyframeEvery = 64
+	}
+	fs.IntVar(&c.KeyframeEvery, "keyframe-every", c.KeyframeEvery, "log a whole universe every this many frames, and deltas in between")
+	fs.Uint64Var(&c.CheckpointEvery, "checkpoint-every", c.CheckpointEvery, "write a checkpoint beside the log every this many generations")
+	fs.StringVar(&c.Resume, "resume", c.Resume, "carry on the run saved in this checkpoint, in the same log")
+	fs.Uint64Var(&c.MaxGenerations, "max-generations", c.MaxGenerations, "stop at this generation (0 for no limit)")
+	fs.Uint64Var(&c.MaxOps, "max-ops", c.MaxOps, "stop after this many ops in total (0 for no limit)")
+	fs.Var(&c.MaxDuration, "max-duration", "stop after running for this long, e.g. 90m (0 for no limit)")
+	fs.StringVar(&c.Summary, "summary", c.Summary, "write the run summary to this file (default beside the log)")
+	if c.EmergeWindow == 0 {
+		c.EmergeWindow = 10
+	}
+	fs.IntVar(&c.EmergeWindow, "emerge-window", c.EmergeWindow, "stats samples to average for the emergence baseline")
+	if c.EmergeJump == 0 {
+		c.EmergeJump = 1
+	}
+	fs.Float64Var(&c.EmergeJump, "emerge-jump", c.EmergeJump, "rise in high-order entropy (bits per cell) above the baseline that counts as emergence (0 to not look)")
+	fs.BoolVar(&c.Provenance, "provenance", c.Provenance, "track which run wrote each cell, and where it was copied from")
+	fs.StringVar(&c.LineageOut, "lineage-out", c.LineageOut, "with -provenance, write the lineage of the most common replicator here at the end, as DOT if it ends in .dot and JSON otherwise")
+	if c.LineageDepth == 0 {
+		c.LineageDepth = 32
+	}
+	fs.IntVar(&c.LineageDepth, "lineage-depth", c.LineageDepth, "runs to go back in the lineage")
+	fs.BoolVar(&c.Profile, "profile", c.Profile, "count the ops executed, why runs halt and how long they run, in the stats and display")
+	fs.StringVar(&c.StatsOut, "stats-out", c.StatsOut, "write stats every second to this file, as CSV if it ends in .csv and JSON lines otherwise")
+	fs.BoolVar(&c.Quiet, "quiet", c.Quiet, "don't display the universe in the terminal")
+	fs.Var(&c.Inject, "inject", "put a program in the universe at the start, FILE[@ADDR][*COPIES]: hex if FILE ends in .hex, assembly if .s, else the bytes as they are; at a random address if none is given (repeatable)")
+	fs.BoolVar(&c.KmerDelta, "kmer-delta", c.KmerDelta, "display the k-mers that rose and fell the most each second, rather than the most common")
+}
+
+// Duration is a time.Duration that is written as "1h30m0s" in JSON and on
+// the command line.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON also accepts a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		*d = Duration(n)
+		return nil
+	}
+	return d.Set(s)
+}
+
+func (c *Config) StrictName() string {
+	if c.Strict {
+		return "strict"
+	}
+	return "lenient"
+}
+
+// ParseFlags parses args with fs, on which c's flags must have been
+// registered, see RegisterFlags. If -config names a JSON run file it is
+// loaded into c and each of extra. If -resume names a checkpoint its
+// configuration, which includes extra's, is loaded on top of that, so the
+// run carries on as it was.
+// Then any flags given explicitly are applied on top. If no seed was given
+// one is chosen, so that it can be logged and the run reproduced.
+func ParseFlags(fs *flag.FlagSet, args []string, c *Config, extra ...any) error {
+	file := fs.String("config", "", "JSON run file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	configs := append([]any{c}, extra...)
+	c.extra = extra
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if *file != "" {
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if err := loadConfig(b, configs); err != nil {
+			return err
+		}
+	}
+	if c.Resume != "" {
+		cp, err := ReadCheckpoint(c.Resume)
+		if err != nil {
+			return err
+		}
+		if err := loadConfig(cp.Config, configs); err != nil {
+			return err
+		}
+		c.checkpoint = cp
+	}
+	for name, value := range explicit {
+		if r, ok := fs.Lookup(name).Value.(interface{ reset() }); ok {
+			r.reset()
+		}
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	for c.Seed == 0 {
+		c.Seed = rand.Uint64()
+	}
+	switch c.Schedule {
+	case PARALLEL, SERIAL:
+		if c.Epoch < 1 {
+			return errors.New("-epoch must be at least 1")
+		}
+	case ROUND_ROBIN, RANDOM:
+	default:
+		return fmt.Errorf("unknown schedule %q", c.Schedule)
+	}
+	if c.checkpoint != nil {
+		return c.checkpoint.check(c)
+	}
+	return nil
+}
+
+func loadConfig(b []byte, configs []any) error {
+	for _, c := range configs {
+		if err := json.Unmarshal(b, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigJSON merges configs into a single JSON object.
+func ConfigJSON(configs ...any) ([]byte, error) {
+	m := make(map[string]any)
+	for _, c := range configs {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(m)
+}
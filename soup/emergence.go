@@ -0,0 +1,84 @@
+package soup
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Emergence records when replicators took over the soup.
+type Emergence struct {
+	Time       time.Time `json:"time"`
+	Generation uint64    `json:"generation"`
+	NOps       uint64    `json:"n_ops"`
+	HighOrder  float64   `json:"high_order"`
+	Baseline   float64   `json:"baseline"`
+	Checkpoint string    `json:"checkpoint,omitempty"`
+}
+
+// detector watches the high-order entropy of successive samples for the
+// sharp rise that comes when replicators take over: a sample at least jump
+// bits per cell above the mean of the window samples before it. It only
+// fires once.
+type detector struct {
+	window  []float64
+	next    int
+	full    bool
+	emerged *Emergence
+}
+
+func (d *detector) add(st *Stats, window int, jump float64) *Emergence {
+	if d.emerged != nil || window < 1 || jump <= 0 {
+		return nil
+	}
+	if len(d.window) != window {
+		d.window = make([]float64, window)
+	}
+	if d.full {
+		mean := 0.0
+		for _, h := range d.window {
+			mean += h
+		}
+		mean /= float64(window)
+		if st.HighOrder-mean >= jump {
+			d.emerged = &Emergence{
+				Time:       st.Time,
+				Generation: st.Generation,
+				NOps:       st.NOps,
+				HighOrder:  st.HighOrder,
+				Baseline:   mean,
+			}
+			return d.emerged
+		}
+	}
+	d.window[d.next] = st.HighOrder
+	d.next = (d.next + 1) % window
+	d.full = d.full || d.next == 0
+	return nil
+}
+
+// EmergenceName is where the checkpoint taken on emergence is written, next
+// to the log, so that periodic checkpoints don't overwrite it.
+func (s *Soup) EmergenceName() string {
+	if s.Log == nil {
+		return ""
+	}
+	return s.Log.Name() + ".emergence.checkpoint"
+}
+
+// emerge reports emergence and asks the scheduler for a checkpoint. Call
+// with stats_mu held.
+func (s *Soup) emerge(e *Emergence) {
+	e.Checkpoint = s.EmergenceName()
+	fmt.Fprintf(os.Stderr, "emergence at generation %d: high-order entropy %.3f, up from %.3f\n", e.Generation, e.HighOrder, e.Baseline)
+	if e.Checkpoint != "" {
+		s.emerged.Store(true)
+	}
+}
+
+// Emergence returns when replicators emerged, or nil if they haven't.
+func (s *Soup) Emergence() *Emergence {
+	s.stats_mu.Lock()
+	defer s.stats_mu.Unlock()
+	return s.detector.emerged
+}
@@ -0,0 +1,163 @@
+package soup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Injection puts copies of a program into the universe before the run
+// starts, see Soup.Inject.
+type Injection struct {
+	File   string
+	Addr   int // -1 for random
+	Copies int
+}
+
+func (in Injection) String() string {
+	spec := in.File
+	if in.Addr >= 0 {
+		spec += "@" + strconv.Itoa(in.Addr)
+	}
+	if in.Copies != 1 {
+		spec += "*" + strconv.Itoa(in.Copies)
+	}
+	return spec
+}
+
+// Injections is the value of the repeatable -inject flag, each FILE[@ADDR][*N]
+// or several of them separated by commas. In JSON it is a list of them.
+type Injections []Injection
+
+func (is *Injections) String() string {
+	if is == nil {
+		return ""
+	}
+	var specs []string
+	for _, in := range *is {
+		specs = append(specs, in.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+func (is *Injections) Set(specs string) error {
+	for _, spec := range strings.Split(specs, ",") {
+		in := Injection{File: spec, Addr: -1, Copies: 1}
+		var err error
+		if i := strings.LastIndex(in.File, "*"); i >= 0 {
+			if in.Copies, err = strconv.Atoi(in.File[i+1:]); err != nil || in.Copies < 1 {
+				return fmt.Errorf("bad number of copies in %q", spec)
+			}
+			in.File = in.File[:i]
+		}
+		// An @ not followed by an address is part of the name
+		if i := strings.LastIndex(in.File, "@"); i >= 0 {
+			if addr, err := strconv.Atoi(in.File[i+1:]); err == nil && addr >= 0 {
+				in.File, in.Addr = in.File[:i], addr
+			}
+		}
+		if in.File == "" {
+			return fmt.Errorf("no file in %q", spec)
+		}
+		*is = append(*is, in)
+	}
+	return nil
+}
+
+// reset empties the list before ParseFlags applies the flags again.
+func (is *Injections) reset() {
+	*is = nil
+}
+
+func (is Injections) MarshalJSON() ([]byte, error) {
+	specs := []string{}
+	for _, in := range is {
+		specs = append(specs, in.String())
+	}
+	return json.Marshal(specs)
+}
+
+func (is *Injections) UnmarshalJSON(b []byte) error {
+	var specs []string
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return err
+	}
+	*is = nil
+	for _, spec := range specs {
+		if err := is.Set(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Program reads a program to inject: hex if the file name ends in .hex,
+// source for the soup's Assemble if it ends in .s, and the bytes themselves
+// otherwise, which suits bfsoup, whose ops are characters.
+func (s *Soup) Program(name string) ([]uint8, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(name, ".hex"):
+		b, err = hex.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+	case strings.HasSuffix(name, ".s"):
+		if s.Assemble == nil {
+			return nil, fmt.Errorf("%s: this soup has no assembler", name)
+		}
+		b, err = s.Assemble(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(b) == 0 || len(b) > len(s.Universe) {
+		return nil, fmt.Errorf("%s: %d cells won't go in a universe of %d", name, len(b), len(s.Universe))
+	}
+	return b, nil
+}
+
+// Inject puts the programs in Config.Inject into the universe. Copies at
+// an address are placed end to end from it; copies at random addresses are
+// placed where they don't overlap any other copy, if there is room. Random
+// addresses come from s.Rand, so they are reproducible. Where each copy
+// went is written to w.
+func (s *Soup) Inject(w io.Writer) error {
+	n := len(s.Universe)
+	used := make([]bool, n)
+	free := func(addr int, l int) bool {
+		for i := 0; i < l; i++ {
+			if used[(addr+i)%n] {
+				return false
+			}
+		}
+		return true
+	}
+	for _, in := range s.Config.Inject {
+		p, err := s.Program(in.File)
+		if err != nil {
+			return err
+		}
+		for c := 0; c < in.Copies; c++ {
+			addr := in.Addr + c*len(p)
+			if in.Addr < 0 {
+				addr = s.Rand.Intn(n)
+				for try := 0; try < 100 && !free(addr, len(p)); try++ {
+					addr = s.Rand.Intn(n)
+				}
+			}
+			addr %= n
+			for i, op := range p {
+				s.Universe[(addr+i)%n] = op
+				used[(addr+i)%n] = true
+			}
+			fmt.Fprintf(w, "injected %s (%d cells) at %d\n", in.File, len(p), addr)
+		}
+	}
+	return nil
+}
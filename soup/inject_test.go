@@ -0,0 +1,57 @@
+package soup
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInjections(t *testing.T) {
+	var is Injections
+	assert.NilError(t, is.Set("a.s@100*3,b.hex"))
+	assert.NilError(t, is.Set("c@d.bf*2"))
+	assert.DeepEqual(t, is, Injections{{"a.s", 100, 3}, {"b.hex", -1, 1}, {"c@d.bf", -1, 2}})
+	assert.Equal(t, is.String(), "a.s@100*3,b.hex,c@d.bf*2")
+	assert.ErrorContains(t, is.Set("a.s*0"), "bad number of copies")
+	assert.ErrorContains(t, is.Set("@3"), "no file")
+
+	b, err := json.Marshal(&Config{Inject: is[:1]})
+	assert.NilError(t, err)
+	var c Config
+	assert.NilError(t, json.Unmarshal(b, &c))
+	assert.DeepEqual(t, c.Inject, is[:1])
+}
+
+func TestInject(t *testing.T) {
+	dir := t.TempDir()
+	hex := filepath.Join(dir, "p.hex")
+	assert.NilError(t, os.WriteFile(hex, []byte("0102\n03 04\n"), 0666))
+	src := filepath.Join(dir, "p.s")
+	assert.NilError(t, os.WriteFile(src, []byte("INC"), 0666))
+
+	s := NewSoup(copier{}, &Config{ULen: 64, Seed: 1})
+	s.Config.Inject.Set(hex + "@62*2")
+	s.Config.Inject.Set(hex + "*10")
+	assert.NilError(t, s.Inject(io.Discard))
+	assert.DeepEqual(t, s.Universe[:6], Universe{3, 4, 1, 2, 3, 4})
+	assert.DeepEqual(t, s.Universe[62:], Universe{1, 2})
+	// The random copies don't overlap
+	h := s.Universe.Histogram()
+	assert.Equal(t, h[1], 12)
+	assert.Equal(t, h[4], 12)
+
+	s.Config.Inject = nil
+	s.Config.Inject.Set(src)
+	assert.ErrorContains(t, s.Inject(io.Discard), "no assembler")
+	s.Assemble = func(r io.Reader) ([]uint8, error) {
+		b, err := io.ReadAll(r)
+		return append(b, '!'), err
+	}
+	s.Config.Inject[0].Addr = 10
+	assert.NilError(t, s.Inject(io.Discard))
+	assert.Equal(t, string(s.Universe[10:14]), "INC!")
+}
@@ -0,0 +1,171 @@
+package soup
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"pgregory.net/rand"
+)
+
+// Harness runs a candidate sequence alone in an otherwise inert universe,
+// to tell a replicator from junk. The candidate is put at cell 0 of ULen
+// cells of Filler, which should be an op that does nothing, and run Runs
+// times.
+type Harness struct {
+	ISA    ISA // Must be a Tracer
+	ULen   int
+	Filler uint8
+	Runs   int
+	Rand   *rand.Rand // For the pcs of random runs
+}
+
+// Isolation is what a candidate did in the harness. An attempt is a run of
+// adjacent cells written outside the candidate; its fidelity is the share
+// of the candidate's cells it reproduces, lined up as well as they can be.
+type Isolation struct {
+	Runs       int     `json:"runs"`
+	Ops        uint64  `json:"ops"`
+	Copies     int     `json:"copies"`   // Exact copies at the end
+	Attempts   int     `json:"attempts"` // Including the exact copies
+	Fidelity   float64 `json:"fidelity"` // Mean over the attempts
+	Best       float64 `json:"best"`     // The best attempt's fidelity
+	FirstCopy  int     `json:"first_copy"`
+	FirstOps   uint64  `json:"first_ops"`  // Ops run until the first copy
+	Functional int     `json:"functional"` // Distinct attempts that copy themselves from their start
+	Damaged    bool    `json:"damaged"`    // The candidate was changed
+}
+
+func (is *Isolation) String() string {
+	first := "none"
+	if is.FirstCopy > 0 {
+		first = fmt.Sprintf("run %d, after %d ops", is.FirstCopy, is.FirstOps)
+	}
+	s := fmt.Sprintf("%d runs, %d ops: %d copies, %d attempts, fidelity mean %.2f best %.2f, first copy %s, %d functional",
+		is.Runs, is.Ops, is.Copies, is.Attempts, is.Fidelity, is.Best, first, is.Functional)
+	if is.Damaged {
+		s += ", damaged"
+	}
+	return s
+}
+
+// Isolate runs candidate from its start each time, or with random from a
+// random pc within it, and reports what it made. Each distinct attempt is
+// then run from its own start, as the candidate was, to see whether it
+// makes an exact copy of itself.
+func (h *Harness) Isolate(candidate []uint8, random bool) (*Isolation, error) {
+	if _, ok := h.ISA.(Tracer); !ok {
+		return nil, fmt.Errorf("%T can't say which cells its runs write", h.ISA)
+	}
+	if len(candidate) == 0 || 2*len(candidate) > h.ULen {
+		return nil, fmt.Errorf("a candidate of %d cells needs a universe of at least twice that, not %d", len(candidate), h.ULen)
+	}
+	is, u, written := h.isolate(candidate, random, false)
+
+	k := len(candidate)
+	tried := make(map[string]bool)
+	for a := k; a < len(u); {
+		if !written[a] {
+			a++
+			continue
+		}
+		b := a
+		for b < len(u) && written[b] {
+			b++
+		}
+		f, seq := fidelity(candidate, u, a, b)
+		is.Attempts++
+		is.Fidelity += f
+		is.Best = max(is.Best, f)
+		if !tried[string(seq)] {
+			tried[string(seq)] = true
+			if c, _, _ := h.isolate(seq, false, true); c.Copies > 0 {
+				is.Functional++
+			}
+		}
+		a = b
+	}
+	if is.Attempts > 0 {
+		is.Fidelity /= float64(is.Attempts)
+	}
+	return is, nil
+}
+
+// isolate does the runs, stopping at the first copy if first is set, and
+// returns the universe they leave and which cells they wrote.
+func (h *Harness) isolate(candidate []uint8, random bool, first bool) (*Isolation, Universe, []bool) {
+	k := len(candidate)
+	u := make(Universe, h.ULen)
+	u.Fill(h.Filler)
+	copy(u, candidate)
+	written := make([]bool, len(u))
+	wrote := false
+	is := &Isolation{FirstCopy: -1}
+	for is.Runs < h.Runs {
+		pc := 0
+		if random {
+			pc = h.Rand.Intn(k)
+		}
+		wrote = false
+		is.Runs++
+		is.Ops += uint64(h.ISA.(Tracer).RunTraced(u, pc, func(dst int, src int) {
+			written[dst] = true
+			wrote = true
+		}))
+		if wrote && is.FirstCopy < 0 && copies(u, candidate, written) > 0 {
+			is.FirstCopy, is.FirstOps = is.Runs, is.Ops
+			if first {
+				break
+			}
+		}
+	}
+	is.Copies = copies(u, candidate, written)
+	is.Damaged = !bytes.Equal(u[:k], candidate)
+	return is, u, written
+}
+
+// copies counts the exact copies of the candidate, not overlapping each
+// other, that runs wrote at least a cell of, so that one made of filler
+// doesn't count. They can't overlap the candidate either, so they don't
+// wrap around the end.
+func copies(u Universe, candidate []uint8, written []bool) int {
+	n := 0
+	for i := len(candidate); ; {
+		j := bytes.Index(u[i:], candidate)
+		if j < 0 {
+			return n
+		}
+		i += j
+		if slices.Contains(written[i:i+len(candidate)], true) {
+			n++
+			i += len(candidate)
+		} else {
+			i++
+		}
+	}
+}
+
+// fidelity lines up cells a to b of u with the candidate as well as they
+// can be, and returns the share of the candidate they match and the
+// candidate-sized window of u that lines up with it.
+func fidelity(candidate []uint8, u Universe, a int, b int) (float64, []uint8) {
+	k := len(candidate)
+	best, at := -1, 0
+	// Cell a+i lines up with candidate[i+s]
+	for s := -(b - a - 1); s < k; s++ {
+		n := 0
+		for i := max(0, -s); i < b-a && i+s < k; i++ {
+			if u[a+i] == candidate[i+s] {
+				n++
+			}
+		}
+		if n > best {
+			best, at = n, s
+		}
+	}
+	seq := make([]uint8, k)
+	for j := range seq {
+		seq[j] = u[Pmod(a-at+j, len(u))]
+	}
+	return float64(best) / float64(k), seq
+}
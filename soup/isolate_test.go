@@ -0,0 +1,63 @@
+package soup
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"pgregory.net/rand"
+)
+
+// shifter copies as many cells as the one after pc says, from pc, on by as
+// many as the one at pc says.
+type shifter struct{ glyphs }
+
+func (s shifter) Run(universe []uint8, pc int) int { return s.RunTraced(universe, pc, nil) }
+
+func (shifter) RunTraced(universe []uint8, pc int, wrote func(dst int, src int)) int {
+	l := len(universe)
+	k, n := int(universe[pc]), int(universe[(pc+1)%l])
+	for i := 0; i < n; i++ {
+		src, dst := (pc+i)%l, (pc+k+i)%l
+		universe[dst] = universe[src]
+		if wrote != nil {
+			wrote(dst, src)
+		}
+	}
+	return max(n, 1)
+}
+
+func TestIsolate(t *testing.T) {
+	h := Harness{ISA: shifter{}, ULen: 32, Runs: 5, Rand: rand.New(1)}
+
+	// Copies all of itself just after itself, in its first run
+	is, err := h.Isolate([]uint8{3, 3, 9}, false)
+	assert.NilError(t, err)
+	assert.Equal(t, is.Runs, 5)
+	assert.Equal(t, is.Ops, uint64(15))
+	assert.Equal(t, is.Copies, 1)
+	assert.Equal(t, is.Attempts, 1)
+	assert.Equal(t, is.Fidelity, 1.0)
+	assert.Equal(t, is.Best, 1.0)
+	assert.Equal(t, is.FirstCopy, 1)
+	assert.Equal(t, is.FirstOps, uint64(3))
+	assert.Equal(t, is.Functional, 1)
+	assert.Assert(t, !is.Damaged)
+
+	// Copies only its first cell, which copies nothing in turn
+	is, err = h.Isolate([]uint8{3, 1, 9}, false)
+	assert.NilError(t, err)
+	assert.Equal(t, is.Ops, uint64(5))
+	assert.Equal(t, is.Copies, 0)
+	assert.Equal(t, is.Attempts, 1)
+	assert.Equal(t, is.Fidelity, 1.0/3)
+	assert.Equal(t, is.Best, 1.0/3)
+	assert.Equal(t, is.FirstCopy, -1)
+	assert.Equal(t, is.FirstOps, uint64(0))
+	assert.Equal(t, is.Functional, 0)
+	assert.Assert(t, !is.Damaged)
+
+	_, err = h.Isolate(make([]uint8, 17), false)
+	assert.ErrorContains(t, err, "at least twice")
+	_, err = (&Harness{ISA: glyphs{}, ULen: 32}).Isolate([]uint8{1}, false)
+	assert.ErrorContains(t, err, "can't say which cells")
+}
@@ -0,0 +1,181 @@
+package soup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KMER_BASE is the multiplier of the rolling hash. Hashes are mod 2^64, so
+// with n cells the chance of two different k-mers colliding is about
+// n^2/2^64.
+const KMER_BASE = 0x100000001b3
+
+// Kmer is a sequence of k cells and how often it occurs.
+type Kmer struct {
+	Seq   []uint8
+	Count int
+	Delta int // Change since the previous frame, see KmerCounter
+}
+
+type kcount struct {
+	count int32
+	pos   int32 // First occurrence
+}
+
+// kmers counts every sequence of k cells in u, including those wrapping
+// around the end, by a rolling hash of the raw ops.
+func (u Universe) kmers(k int) map[uint64]kcount {
+	n := len(u)
+	if k < 1 || k > n {
+		return nil
+	}
+	top := uint64(1) // KMER_BASE^(k-1)
+	h := uint64(0)
+	for j := 0; j < k; j++ {
+		if j > 0 {
+			top *= KMER_BASE
+		}
+		h = h*KMER_BASE + uint64(u[j])
+	}
+	m := make(map[uint64]kcount, n/4)
+	for i := 0; i < n; i++ {
+		c, ok := m[h]
+		if !ok {
+			c.pos = int32(i)
+		}
+		c.count++
+		m[h] = c
+		h = (h-uint64(u[i])*top)*KMER_BASE + uint64(u[(i+k)%n])
+	}
+	return m
+}
+
+func (u Universe) seq(pos int32, k int) []uint8 {
+	s := make([]uint8, k)
+	for j := range s {
+		s[j] = u[(int(pos)+j)%len(u)]
+	}
+	return s
+}
+
+// TopKmers returns the top most common k-mers in u, most common first.
+func (u Universe) TopKmers(k int, top int) []Kmer {
+	before := func(a kcount, b kcount) bool {
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.pos < b.pos
+	}
+	// Insert into a short sorted list, rather than sorting them all
+	best := make([]kcount, 0, top+1)
+	for _, c := range u.kmers(k) {
+		if len(best) == top && !before(c, best[top-1]) {
+			continue
+		}
+		i := sort.Search(len(best), func(i int) bool {
+			return before(c, best[i])
+		})
+		best = append(best, kcount{})
+		copy(best[i+1:], best[i:])
+		best[i] = c
+		best = best[:min(len(best), top)]
+	}
+	var out []Kmer
+	for _, c := range best {
+		out = append(out, Kmer{Seq: u.seq(c.pos, k), Count: int(c.count)})
+	}
+	return out
+}
+
+// KmerCounter counts k-mers frame after frame, remembering each k's counts
+// so that it can say which k-mers rose or fell since the previous frame.
+type KmerCounter struct {
+	frames map[int]kframe
+}
+
+type kframe struct {
+	u      Universe
+	counts map[uint64]kcount
+}
+
+// Deltas counts the k-mers in u and returns the top that rose the most, and
+// the top that fell the most, since the last call for k. The first call
+// compares with an empty universe.
+func (c *KmerCounter) Deltas(u Universe, k int, top int) (rose []Kmer, fell []Kmer) {
+	if c.frames == nil {
+		c.frames = make(map[int]kframe)
+	}
+	u = append(Universe{}, u...)
+	counts := u.kmers(k)
+	prev := c.frames[k]
+	c.frames[k] = kframe{u, counts}
+
+	type delta struct {
+		kcount
+		d int
+		u Universe // Where pos is
+	}
+	var deltas []delta
+	for h, kc := range counts {
+		if d := int(kc.count - prev.counts[h].count); d != 0 {
+			deltas = append(deltas, delta{kc, d, u})
+		}
+	}
+	for h, kc := range prev.counts {
+		if _, ok := counts[h]; !ok {
+			deltas = append(deltas, delta{kcount{0, kc.pos}, -int(kc.count), prev.u})
+		}
+	}
+	// Biggest rise first, biggest fall last
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := deltas[i], deltas[j]
+		if a.d != b.d {
+			return a.d > b.d
+		}
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.pos < b.pos
+	})
+	kmer := func(d delta) Kmer {
+		return Kmer{Seq: d.u.seq(d.pos, k), Count: int(d.count), Delta: d.d}
+	}
+	for i := 0; i < len(deltas) && i < top && deltas[i].d > 0; i++ {
+		rose = append(rose, kmer(deltas[i]))
+	}
+	for i := len(deltas) - 1; i >= 0 && len(deltas)-i <= top && deltas[i].d < 0; i-- {
+		fell = append(fell, kmer(deltas[i]))
+	}
+	return rose, fell
+}
+
+// Show prints a line of the most common k-mers in u, rendered by glyph,
+// leaving out any no more than a tenth as common as the first. With delta
+// it prints those that rose and fell the most since the last frame instead.
+func (c *KmerCounter) Show(u Universe, glyph func(op uint8) string, k int, delta bool) {
+	render := func(seq []uint8) string {
+		var b strings.Builder
+		for _, op := range seq {
+			b.WriteString(glyph(op))
+		}
+		return b.String()
+	}
+	if delta {
+		rose, fell := c.Deltas(u, k, 4)
+		for _, km := range rose {
+			fmt.Printf("% 15s% +5d ", render(km.Seq), km.Delta)
+		}
+		for _, km := range fell {
+			fmt.Printf("% 15s% +5d ", render(km.Seq), km.Delta)
+		}
+		return
+	}
+	top := u.TopKmers(k, 8)
+	for _, km := range top {
+		if km.Count <= top[0].Count/10 {
+			break
+		}
+		fmt.Printf("% 15s% 5d ", render(km.Seq), km.Count)
+	}
+}
@@ -0,0 +1,48 @@
+package soup
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"pgregory.net/rand"
+)
+
+func TestKmers(t *testing.T) {
+	u := Universe{0, 1, 0, 1, 0, 1, 2}
+	top := u.TopKmers(2, 8)
+	assert.DeepEqual(t, top[0], Kmer{Seq: []uint8{0, 1}, Count: 3})
+	assert.DeepEqual(t, top[1], Kmer{Seq: []uint8{1, 0}, Count: 2})
+	// Wrapping around
+	assert.DeepEqual(t, top[3], Kmer{Seq: []uint8{2, 0}, Count: 1})
+
+	r := rand.New(1)
+	u = make(Universe, 1000)
+	for i := range u {
+		u[i] = uint8(r.Intn(3))
+	}
+	for k := 1; k < 12; k++ {
+		counts := make(map[string]int)
+		for i := range u {
+			counts[string(rotation(u, i)[:k])]++
+		}
+		kmers := u.TopKmers(k, len(u))
+		assert.Equal(t, len(kmers), len(counts), "k %d", k)
+		for _, km := range kmers {
+			assert.Equal(t, km.Count, counts[string(km.Seq)], "k %d", k)
+		}
+	}
+}
+
+func TestKmerDeltas(t *testing.T) {
+	var c KmerCounter
+	u := Universe{0, 1, 0, 1, 0, 1, 0, 1}
+	rose, fell := c.Deltas(u, 2, 4)
+	assert.Equal(t, len(rose), 2)
+	assert.Equal(t, len(fell), 0)
+
+	u = Universe{0, 1, 0, 1, 2, 2, 2, 2}
+	rose, fell = c.Deltas(u, 2, 4)
+	assert.DeepEqual(t, rose[0], Kmer{Seq: []uint8{2, 2}, Count: 3, Delta: 3})
+	assert.DeepEqual(t, fell[0], Kmer{Seq: []uint8{1, 0}, Count: 1, Delta: -3})
+	assert.DeepEqual(t, fell[1], Kmer{Seq: []uint8{0, 1}, Count: 2, Delta: -2})
+}
@@ -0,0 +1,418 @@
+package soup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+/*
+Log format
+
+A log starts with the 8 byte magic LOG_MAGIC, then a uint32 format version
+and a uint32 header length, followed by the header itself as JSON:
+
+	{
+	  "isa": "f5",
+	  "seed": 1234,
+	  "params": {"ulen": 65536, "slen": 1024, ...},
+	  "frame": [
+	    {"name": "generation", "type": "u64"},
+	    {"name": "n_ops", "type": "u64"},
+	    {"name": "universe", "type": "u8", "len": 65536}
+	  ],
+	  "encoding": {"codec": "flate", "keyframe_every": 64}
+	}
+
+params is the full effective configuration, frame describes the fields of
+each frame in order. All integers are little endian.
+
+Each frame is a record:
+
+	kind       u8   KEYFRAME, DELTA or INDEX
+	generation u64
+	length     u32
+	payload    [length]byte
+
+The payload is compressed with the codec. A keyframe's payload is the raw
+frame, a delta's is the raw frame XORed with the previous frame, so cells
+that didn't change are zero and compress to almost nothing. There is a
+keyframe every keyframe_every frames.
+
+When the log is closed an INDEX record is written whose payload lists every
+frame record as generation (u64), offset (u64) and kind (u8), followed by
+the offset of the INDEX record as a u64 and INDEX_MAGIC. Readers that don't
+find it, because the writer was killed, scan the records instead.
+
+Older logs have no magic. They start with five uint64s, nominally ULen,
+SLen, ILimit, MutationRate and Runners (though f4 wrote its initial energy
+in place of ILimit). f3 and f4 frames are generation then the universe, f5,
+f6 and bfsoup frames are generation, n_ops then the universe.
+*/
+
+const LOG_MAGIC = "SOUPLOG\x00"
+const INDEX_MAGIC = "SOUPIDX\x00"
+const LOG_VERSION = 2
+
+// Frame field types.
+const (
+	U8  = "u8"
+	U64 = "u64"
+)
+
+// Record kinds.
+const (
+	KEYFRAME = 0
+	DELTA    = 1
+	INDEX    = 2
+)
+
+const RECORD_HEADER_LEN = 13
+
+// Field describes one field of a frame. Len is the number of values, 0 is
+// the same as 1.
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Len  int    `json:"len,omitempty"`
+}
+
+func (f Field) size() int {
+	n := f.Len
+	if n == 0 {
+		n = 1
+	}
+	if f.Type == U64 {
+		return n * 8
+	}
+	return n
+}
+
+// Encoding describes how frames are stored.
+type Encoding struct {
+	Codec         string `json:"codec"`
+	KeyframeEvery int    `json:"keyframe_every"`
+}
+
+// LogHeader describes a log.
+type LogHeader struct {
+	Version  int            `json:"-"`
+	Legacy   string         `json:"-"` // The legacy layout, if any
+	ISA      string         `json:"isa"`
+	Seed     uint64         `json:"seed"`
+	Params   map[string]any `json:"params"`
+	Frame    []Field        `json:"frame"`
+	Encoding *Encoding      `json:"encoding,omitempty"`
+}
+
+// Param returns the named integer parameter.
+func (h *LogHeader) Param(name string) (int, bool) {
+	v, ok := h.Params[name].(float64)
+	return int(v), ok
+}
+
+// ULen is the length of the universe in each frame.
+func (h *LogHeader) ULen() int {
+	for _, f := range h.Frame {
+		if f.Name == "universe" {
+			return f.Len
+		}
+	}
+	return 0
+}
+
+// Config returns the configuration recorded in the header.
+func (h *LogHeader) Config() (*Config, error) {
+	j, err := json.Marshal(h.Params)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(j, c); err != nil {
+		return nil, err
+	}
+	if c.Seed == 0 {
+		c.Seed = h.Seed
+	}
+	return c, nil
+}
+
+// Limits sets c's stack length, iteration limit and strictness to those
+// recorded in the header, but for any given as -slen, -ilimit or -strict
+// on fs.
+func (h *LogHeader) Limits(c *Config, fs *flag.FlagSet) error {
+	lc, err := h.Config()
+	if err != nil {
+		return err
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if !given["slen"] {
+		c.SLen = lc.SLen
+	}
+	if !given["ilimit"] {
+		c.ILimit = lc.ILimit
+	}
+	if !given["strict"] {
+		c.Strict = lc.Strict
+	}
+	return nil
+}
+
+func (h *LogHeader) frameSize() int {
+	n := 0
+	for _, f := range h.Frame {
+		n += f.size()
+	}
+	return n
+}
+
+// IndexEntry locates a frame record in a log.
+type IndexEntry struct {
+	Generation uint64
+	Offset     int64
+	Kind       uint8
+}
+
+// Logger writes universe snapshots to a log file.
+type Logger struct {
+	mu    sync.Mutex
+	name  string
+	f     *os.File
+	w     *bufio.Writer
+	every int
+	off   int64
+
+	frame []byte
+	prev  []byte
+	z     *flate.Writer
+	zbuf  bytes.Buffer
+	index []IndexEntry
+
+	closed bool
+}
+
+// NewLogger creates a log of the named ISA. extra holds any command specific
+// configuration to be recorded in the header along with c.
+//
+// If c is resuming a checkpoint the log it was writing is reopened instead,
+// and cut back to where it was when the checkpoint was taken.
+func NewLogger(name string, isa string, c *Config, extra ...any) (*Logger, error) {
+	return NewFieldLogger(name, isa, c, nil, extra...)
+}
+
+// NewFieldLogger is NewLogger for frames with more fields after the
+// universe, whose values are given to DumpFields.
+func NewFieldLogger(name string, isa string, c *Config, fields []Field, extra ...any) (*Logger, error) {
+	if c.checkpoint != nil && c.checkpoint.Log != "" {
+		return reopenLogger(c.checkpoint.Log, c.checkpoint.LogOffset)
+	}
+	j, err := ConfigJSON(append([]any{c}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	every := c.KeyframeEvery
+	if every < 1 {
+		every = 1
+	}
+	h := LogHeader{
+		ISA:  isa,
+		Seed: c.Seed,
+		Frame: []Field{
+			{Name: "generation", Type: U64},
+			{Name: "n_ops", Type: U64},
+			{Name: "universe", Type: U8, Len: c.ULen},
+		},
+		Encoding: &Encoding{Codec: "flate", KeyframeEvery: every},
+	}
+	h.Frame = append(h.Frame, fields...)
+	if err := json.Unmarshal(j, &h.Params); err != nil {
+		return nil, err
+	}
+	hj, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{
+		name:  name,
+		f:     f,
+		w:     bufio.NewWriterSize(f, 1<<16),
+		every: every,
+		frame: make([]byte, h.frameSize()),
+	}
+	l.z, _ = flate.NewWriter(&l.zbuf, flate.DefaultCompression)
+	l.w.WriteString(LOG_MAGIC)
+	binary.Write(l.w, binary.LittleEndian, uint32(LOG_VERSION))
+	binary.Write(l.w, binary.LittleEndian, uint32(len(hj)))
+	l.w.Write(hj)
+	l.off = int64(16 + len(hj))
+	return l, l.w.Flush()
+}
+
+// Dump writes a frame. Each frame is flushed to the file whole, so a log
+// that is cut short loses at most the frame being written. Frames dumped
+// after Close are dropped.
+func (l *Logger) Dump(generation uint64, n_ops uint64, universe Universe) {
+	l.DumpFields(generation, n_ops, universe)
+}
+
+// DumpFields is Dump with the values of the fields given to NewFieldLogger,
+// in order, as raw little endian bytes.
+func (l *Logger) DumpFields(generation uint64, n_ops uint64, universe Universe, fields ...[]byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	binary.LittleEndian.PutUint64(l.frame, generation)
+	binary.LittleEndian.PutUint64(l.frame[8:], n_ops)
+	b := l.frame[16+copy(l.frame[16:], universe):]
+	for _, f := range fields {
+		b = b[copy(b, f):]
+	}
+
+	if len(l.index)%l.every != 0 {
+		for i := range l.prev {
+			l.prev[i] ^= l.frame[i]
+		}
+		l.record(DELTA, generation, l.prev)
+	} else {
+		l.record(KEYFRAME, generation, l.frame)
+	}
+	l.prev = append(l.prev[:0], l.frame...)
+	l.w.Flush()
+}
+
+// record compresses and writes a record, and adds it to the index.
+func (l *Logger) record(kind uint8, generation uint64, payload []byte) {
+	l.zbuf.Reset()
+	l.z.Reset(&l.zbuf)
+	l.z.Write(payload)
+	l.z.Close()
+
+	if kind != INDEX {
+		l.index = append(l.index, IndexEntry{Generation: generation, Offset: l.off, Kind: kind})
+	}
+	var h [RECORD_HEADER_LEN]byte
+	h[0] = kind
+	binary.LittleEndian.PutUint64(h[1:], generation)
+	binary.LittleEndian.PutUint32(h[9:], uint32(l.zbuf.Len()))
+	l.w.Write(h[:])
+	l.w.Write(l.zbuf.Bytes())
+	l.off += int64(len(h) + l.zbuf.Len())
+}
+
+// reopenLogger opens an existing log to carry on writing it from
+// off, the end of a frame record, dropping anything after that.
+func reopenLogger(name string, off int64) (*Logger, error) {
+	r, f, err := OpenLog(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := &r.Header
+	if h.Version != LOG_VERSION {
+		return nil, fmt.Errorf("%s: can only carry on version %d logs", name, LOG_VERSION)
+	}
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].Offset >= off
+	})
+	index = index[:i]
+
+	l := &Logger{
+		name:  name,
+		every: h.Encoding.KeyframeEvery,
+		off:   off,
+		frame: make([]byte, h.frameSize()),
+		index: index,
+	}
+	if len(index) > 0 {
+		if err := r.SeekGeneration(index[len(index)-1].Generation); err != nil {
+			return nil, err
+		}
+		if _, err := r.Next(); err != nil {
+			return nil, err
+		}
+		l.prev = append([]byte{}, r.prev...)
+	}
+
+	l.f, err = os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.f.Truncate(off); err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	if _, err := l.f.Seek(off, io.SeekStart); err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	l.w = bufio.NewWriterSize(l.f, 1<<16)
+	l.z, _ = flate.NewWriter(&l.zbuf, flate.DefaultCompression)
+	return l, nil
+}
+
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// Offset is the end of the last frame written.
+func (l *Logger) Offset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.off
+}
+
+// Generation is the generation of the last frame written, if any.
+func (l *Logger) Generation() (uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.index) == 0 {
+		return 0, false
+	}
+	return l.index[len(l.index)-1].Generation, true
+}
+
+// Close writes the index and closes the file. Closing it again does
+// nothing.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	b := make([]byte, 0, len(l.index)*17)
+	for _, e := range l.index {
+		b = binary.LittleEndian.AppendUint64(b, e.Generation)
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.Offset))
+		b = append(b, e.Kind)
+	}
+	off := l.off
+	l.record(INDEX, 0, b)
+	binary.Write(l.w, binary.LittleEndian, uint64(off))
+	l.w.WriteString(INDEX_MAGIC)
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,144 @@
+package soup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// logged writes a log of n frames, where frame i has generation 10*i and
+// cell i%ULen changed.
+func logged(t *testing.T, n int) (string, []Universe) {
+	name := filepath.Join(t.TempDir(), "log")
+	c := Config{ULen: 32, SLen: 4, Seed: 99, KeyframeEvery: 3}
+	extra := struct {
+		Food int `json:"food"`
+	}{3}
+	l, err := NewLogger(name, "test", &c, &extra)
+	assert.NilError(t, err)
+	u := make(Universe, 32)
+	var us []Universe
+	for i := 0; i < n; i++ {
+		u[i%32]++
+		l.Dump(uint64(10*i), uint64(20*i), u)
+		us = append(us, append(Universe{}, u...))
+	}
+	assert.NilError(t, l.Close())
+	return name, us
+}
+
+func TestLogRoundTrip(t *testing.T) {
+	name, us := logged(t, 8)
+	r, f, err := OpenLog(name)
+	assert.NilError(t, err)
+	defer f.Close()
+	assert.Equal(t, r.Header.Version, LOG_VERSION)
+	assert.Equal(t, r.Header.ISA, "test")
+	assert.Equal(t, r.Header.Seed, uint64(99))
+	assert.Equal(t, r.Header.ULen(), 32)
+	food, _ := r.Header.Param("food")
+	assert.Equal(t, food, 3)
+
+	for i, u := range us {
+		fr, err := r.Next()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, *fr, Frame{Generation: uint64(10 * i), NOps: uint64(20 * i), Universe: u})
+	}
+	_, err = r.Next()
+	assert.Equal(t, err, io.EOF)
+}
+
+func TestLogFields(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	c := Config{ULen: 4, KeyframeEvery: 2}
+	l, err := NewFieldLogger(name, "test", &c, []Field{{Name: "juice", Type: U8, Len: 4}})
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		l.DumpFields(uint64(i), 0, Universe{1, 2, 3, uint8(i)}, []byte{9, 8, 7, uint8(i)})
+	}
+	assert.NilError(t, l.Close())
+
+	r, f, err := OpenLog(name)
+	assert.NilError(t, err)
+	defer f.Close()
+	for i := 0; i < 3; i++ {
+		fr, err := r.Next()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, fr.Universe, Universe{1, 2, 3, uint8(i)})
+		assert.DeepEqual(t, fr.Fields["juice"], []byte{9, 8, 7, uint8(i)})
+	}
+}
+
+func TestLogSeek(t *testing.T) {
+	name, us := logged(t, 8)
+	b, err := os.ReadFile(name)
+	assert.NilError(t, err)
+	// The whole log has an index, a copy cut short in the last frame has to
+	// be scanned
+	r, err := NewLogReader(bytes.NewReader(b))
+	assert.NilError(t, err)
+	want, err := r.Index()
+	assert.NilError(t, err)
+	assert.Equal(t, len(want), 8)
+	cut, err := NewLogReader(bytes.NewReader(b[:want[7].Offset+5]))
+	assert.NilError(t, err)
+	index, err := cut.Index()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, index, want[:7])
+
+	for _, r := range []*LogReader{r, cut} {
+		assert.NilError(t, r.SeekGeneration(45))
+		fr, err := r.Next()
+		assert.NilError(t, err)
+		assert.Equal(t, fr.Generation, uint64(50))
+		assert.DeepEqual(t, fr.Universe, us[5])
+	}
+}
+
+// legacy writes a log in one of the old layouts, with the last frame cut
+// short.
+func legacy(layout string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint64{16, 8, 1000, 400, 8})
+	for g := uint64(1); g <= 3; g++ {
+		binary.Write(&b, binary.LittleEndian, g*100)
+		if layout != LEGACY_F3 {
+			binary.Write(&b, binary.LittleEndian, g*1000)
+		}
+		b.Write(bytes.Repeat([]byte{0x3f}, 16))
+	}
+	return b.Bytes()[:b.Len()-4]
+}
+
+func TestLegacyLogs(t *testing.T) {
+	for _, layout := range []string{LEGACY_F3, LEGACY_F5} {
+		r, err := NewLogReader(bytes.NewReader(legacy(layout)))
+		assert.NilError(t, err)
+		assert.Equal(t, r.Header.Legacy, layout)
+		assert.Equal(t, r.Header.ULen(), 16)
+		ilimit, _ := r.Header.Param("ilimit")
+		assert.Equal(t, ilimit, 1000)
+
+		var generations []uint64
+		for {
+			fr, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, fr.Universe, Universe(bytes.Repeat([]byte{0x3f}, 16)))
+			generations = append(generations, fr.Generation)
+		}
+		assert.DeepEqual(t, generations, []uint64{100, 200})
+
+		assert.NilError(t, r.SeekGeneration(150))
+		fr, err := r.Next()
+		assert.NilError(t, err)
+		assert.Equal(t, fr.Generation, uint64(200))
+	}
+}
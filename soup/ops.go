@@ -0,0 +1,95 @@
+package soup
+
+import (
+	"fmt"
+	"sort"
+
+	"pgregory.net/rand"
+)
+
+// Op is a row of an OpTable. An op with Nibble set takes the low four bits
+// of its code as an operand, and so has the 16 codes from Code up.
+type Op struct {
+	Code     uint8
+	Nibble   bool
+	Mnemonic string
+	Glyph    string // One glyph, or for an op with a nibble one for each value
+	In       int    // Stack entries it takes, which must be there
+	Out      int    // Stack entries it leaves in their place
+	Address  bool   // It adds an offset from the stack to the pc after it
+	Weight   int    // Of each of its codes among random ops
+}
+
+// Check returns why op can't run on a stack of sp entries out of slen, or
+// NONE if it can.
+func (op *Op) Check(sp int, slen int) Halt {
+	if sp < op.In {
+		return UNDERFLOW
+	}
+	if sp-op.In+op.Out > slen {
+		return OVERFLOW
+	}
+	return NONE
+}
+
+// OpTable describes an instruction set once, as a row for each op, for
+// the glyphs, random ops, assembly and stack checks to be derived from.
+// Codes that aren't in it do nothing.
+type OpTable struct {
+	Ops  []Op
+	Junk int // The weight of a random op being any byte at all
+
+	ops     [256]*Op
+	weights []int // Running totals of the weights, by code in codes
+	codes   []uint8
+}
+
+// NewOpTable makes a table of ops, which mustn't share codes.
+func NewOpTable(junk int, ops ...Op) *OpTable {
+	t := &OpTable{Ops: ops, Junk: junk}
+	total := junk
+	for i := range t.Ops {
+		op := &t.Ops[i]
+		n := 1
+		if op.Nibble {
+			n = 16
+		}
+		for c := int(op.Code); c < int(op.Code)+n; c++ {
+			if t.ops[c] != nil {
+				panic(fmt.Sprintf("%s and %s both have code %02x", t.ops[c].Mnemonic, op.Mnemonic, c))
+			}
+			t.ops[c] = op
+			if op.Weight > 0 {
+				total += op.Weight
+				t.weights = append(t.weights, total)
+				t.codes = append(t.codes, uint8(c))
+			}
+		}
+	}
+	return t
+}
+
+// Lookup returns the op with code c, or nil.
+func (t *OpTable) Lookup(c uint8) *Op {
+	return t.ops[c]
+}
+
+func (t *OpTable) Glyph(c uint8) string {
+	op := t.ops[c]
+	switch {
+	case op == nil:
+		return " "
+	case op.Nibble && len(op.Glyph) == 16:
+		return op.Glyph[c&0x0f : c&0x0f+1]
+	}
+	return op.Glyph
+}
+
+// RandomOp draws a code by the weights of the ops, or any byte by Junk.
+func (t *OpTable) RandomOp(r *rand.Rand) uint8 {
+	n := r.Intn(t.weights[len(t.weights)-1])
+	if n < t.Junk {
+		return uint8(r.Intn(256))
+	}
+	return t.codes[sort.SearchInts(t.weights, n+1)]
+}
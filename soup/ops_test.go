@@ -0,0 +1,40 @@
+package soup
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"pgregory.net/rand"
+)
+
+func TestOpTable(t *testing.T) {
+	ops := NewOpTable(1,
+		Op{Code: 0x00, Nibble: true, Mnemonic: "PUSH", Glyph: "0123456789abcdef", Out: 1, Weight: 1},
+		Op{Code: 0x10, Mnemonic: "DUP", Glyph: "=", In: 1, Out: 2, Weight: 16},
+		Op{Code: 0x11, Mnemonic: "NOP", Glyph: "."},
+	)
+	assert.Equal(t, ops.Lookup(0x0c).Mnemonic, "PUSH")
+	assert.Assert(t, ops.Lookup(0x12) == nil)
+	assert.Equal(t, ops.Glyph(0x0c), "c")
+	assert.Equal(t, ops.Glyph(0x10), "=")
+	assert.Equal(t, ops.Glyph(0x12), " ")
+
+	dup := ops.Lookup(0x10)
+	assert.Equal(t, dup.Check(1, 2), NONE)
+	assert.Equal(t, dup.Check(0, 2), UNDERFLOW)
+	assert.Equal(t, dup.Check(2, 2), OVERFLOW)
+
+	// Half PUSHes, half DUPs, no NOPs but for junk
+	r := rand.New(1)
+	var n [256]int
+	for i := 0; i < 33_000; i++ {
+		n[ops.RandomOp(r)]++
+	}
+	pushes := 0
+	for c := 0; c < 16; c++ {
+		pushes += n[c]
+	}
+	assert.Assert(t, pushes > 15_000 && pushes < 17_000, pushes)
+	assert.Assert(t, n[0x10] > 15_000 && n[0x10] < 17_000, n[0x10])
+	assert.Assert(t, n[0x11] < 10, n[0x11])
+}
@@ -0,0 +1,144 @@
+package soup
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Halt is why a run stopped.
+type Halt int
+
+const (
+	ILIMIT    Halt = iota // Ran for the iteration limit
+	UNDERFLOW             // Strict, and an op wanted more of the stack than there was
+	OVERFLOW              // Strict, and an op pushed onto a full stack
+	UNMATCHED             // A bracket with no partner
+	STARVED               // Out of juice, in f7
+	HALTS
+)
+
+// NONE is no halt, for an op that can run, see Op.Check.
+const NONE Halt = -1
+
+var halt_names = [HALTS]string{"ilimit", "underflow", "overflow", "unmatched", "starved"}
+
+func (h Halt) String() string {
+	if h == NONE {
+		return "none"
+	}
+	if h < 0 || h >= HALTS {
+		return fmt.Sprintf("halt(%d)", int(h))
+	}
+	return halt_names[h]
+}
+
+// LENGTHS is the number of run length buckets in a Profile.
+const LENGTHS = 32
+
+// Profile counts what runs did, like cpu1's per-instruction uses and
+// errors.
+type Profile struct {
+	Runs    uint64          `json:"runs"`
+	Ops     [256]uint64     `json:"ops"`     // Executed, by op
+	Halts   [HALTS]uint64   `json:"halts"`   // Runs, by Halt
+	Errors  [256]uint64     `json:"errors"`  // Runs halted by each op, other than by the limit
+	Lengths [LENGTHS]uint64 `json:"lengths"` // Runs of 2^(i-1) up to 2^i - 1 iterations, the last bucket taking the rest
+}
+
+// Profiler is an ISA that can profile its runs.
+type Profiler interface {
+	// RunProfiled is RunTraced, with wrote possibly nil, counting each op
+	// executed in p and, once it halts, why.
+	RunProfiled(universe []uint8, pc int, wrote func(dst int, src int), p *Profile) int
+}
+
+// Halted counts a run halted for h by op, which isn't counted for ILIMIT
+// as the op wasn't at fault.
+func (p *Profile) Halted(h Halt, op uint8) {
+	p.Halts[h]++
+	if h != ILIMIT {
+		p.Errors[op]++
+	}
+}
+
+// Ran counts a run of n iterations.
+func (p *Profile) Ran(n int) {
+	p.Runs++
+	p.Lengths[min(bits.Len(uint(n)), LENGTHS-1)]++
+}
+
+// Add adds q's counts to p.
+func (p *Profile) Add(q *Profile) {
+	p.Runs += q.Runs
+	for i := range p.Ops {
+		p.Ops[i] += q.Ops[i]
+		p.Errors[i] += q.Errors[i]
+	}
+	for i := range p.Halts {
+		p.Halts[i] += q.Halts[i]
+	}
+	for i := range p.Lengths {
+		p.Lengths[i] += q.Lengths[i]
+	}
+}
+
+// Sub returns p less an earlier profile q.
+func (p *Profile) Sub(q *Profile) *Profile {
+	d := *p
+	d.Runs -= q.Runs
+	for i := range d.Ops {
+		d.Ops[i] -= q.Ops[i]
+		d.Errors[i] -= q.Errors[i]
+	}
+	for i := range d.Halts {
+		d.Halts[i] -= q.Halts[i]
+	}
+	for i := range d.Lengths {
+		d.Lengths[i] -= q.Lengths[i]
+	}
+	return &d
+}
+
+// String gives the share of runs halting for each reason.
+func (p *Profile) String() string {
+	var b strings.Builder
+	for h, n := range p.Halts {
+		if h > 0 {
+			b.WriteString(" ")
+		}
+		share := 0.0
+		if p.Runs != 0 {
+			share = float64(n) / float64(p.Runs) * 100
+		}
+		fmt.Fprintf(&b, "%s %.1f%%", Halt(h), share)
+	}
+	return b.String()
+}
+
+// profile sets up the soup's and runners' profiles, if wanted. It panics if
+// the ISA can't profile its runs.
+func (s *Soup) profile() {
+	if !s.Config.Profile {
+		return
+	}
+	if _, ok := s.ISA.(Profiler); !ok {
+		panic(fmt.Sprintf("%T can't profile its runs", s.ISA))
+	}
+	s.prof = &Profile{}
+	for _, r := range s.runners {
+		r.prof = &Profile{}
+	}
+}
+
+// Profile returns the profile of every run so far in this process, or nil
+// if profiling isn't on.
+func (s *Soup) Profile() *Profile {
+	if s.prof == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := *s.prof
+	return &p
+}
@@ -0,0 +1,33 @@
+package soup
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func profiling(c *Config) { c.Profile = true }
+
+func TestProfile(t *testing.T) {
+	for _, schedule := range []string{PARALLEL, ROUND_ROBIN} {
+		s := ran(copier{}, scheduling(schedule), tracing, profiling)
+
+		p := s.Profile()
+		assert.Equal(t, p.Runs, s.Generation())
+		assert.Equal(t, p.Halts[ILIMIT]+p.Halts[UNDERFLOW], p.Runs)
+		assert.Equal(t, p.Lengths[1], p.Runs)
+		ops := uint64(0)
+		for _, n := range p.Ops {
+			ops += n
+		}
+		assert.Equal(t, ops, s.NOps())
+		assert.Equal(t, p.Errors[0], p.Halts[UNDERFLOW])
+		assert.Assert(t, p.Errors[0] > 0)
+
+		st := s.Sample(s.Universe, s.Generation(), s.NOps())
+		assert.DeepEqual(t, st.Profile, p)
+		st = s.Sample(s.Universe, s.Generation(), s.NOps())
+		assert.DeepEqual(t, st.Profile, &Profile{})
+	}
+	assert.Equal(t, UNMATCHED.String(), "unmatched")
+}
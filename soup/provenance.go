@@ -0,0 +1,294 @@
+package soup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+Provenance
+
+With Config.Provenance set every cell is tagged with the run that last
+wrote it and, if the value was copied, the cell it was copied from. Runs are
+numbered from 1 so that the numbers don't depend on the schedule: runner i's
+k-th run is k*Runners + i + 1. Run 0 stands for the initial universe and
+for mutations, which have no ancestry.
+
+Each run that writes any cells becomes a node in the lineage graph, with an
+edge from each run whose cells it copied. Nodes that no cell descends from
+any more, or only from further back than Config.LineageDepth, are pruned
+from time to time, so the graph only holds the recent ancestry of the
+current universe. Tags and nodes are kept in the runners' views and
+committed with them, so provenance doesn't change how the soup evolves.
+*/
+
+// Tag says which run last wrote a cell, and where from.
+type Tag struct {
+	Run uint64 `json:"run"`
+	Src int32  `json:"src"` // -1 if the value wasn't copied
+}
+
+// Node is a run in the lineage graph.
+type Node struct {
+	Run        uint64 `json:"run"`
+	Generation uint64 `json:"generation"` // When it was committed
+	Cells      int    `json:"cells"`      // Writes
+	Copied     int    `json:"copied"`     // Writes copied from another cell
+	Parents    []Edge `json:"parents,omitempty"`
+}
+
+// Edge says a run copied cells last written by another.
+type Edge struct {
+	Run   uint64 `json:"run"`
+	Cells int    `json:"cells"`
+}
+
+func (n *Node) parent(run uint64) {
+	for i := range n.Parents {
+		if n.Parents[i].Run == run {
+			n.Parents[i].Cells++
+			return
+		}
+	}
+	n.Parents = append(n.Parents, Edge{Run: run, Cells: 1})
+}
+
+// provenance is the tags of a universe or a runner's view of it, and the
+// runs a runner has made that haven't been committed.
+type provenance struct {
+	tags   []Tag
+	nodes  []*Node
+	next   uint64 // Runner only
+	stride uint64
+}
+
+// run does a traced run for r, numbering it and recording its writes.
+func (p *provenance) run(r *Runner, pc int) int {
+	id := p.next
+	p.next += p.stride
+	var node *Node
+	n := r.run(pc, func(dst int, src int) {
+		if node == nil {
+			node = &Node{Run: id}
+		}
+		node.Cells++
+		tag := Tag{Run: id, Src: -1}
+		if src >= 0 {
+			node.Copied++
+			tag.Src = int32(src)
+			if parent := p.tags[src].Run; parent != id {
+				node.parent(parent)
+			}
+		}
+		p.tags[dst] = tag
+	})
+	if node != nil {
+		p.nodes = append(p.nodes, node)
+	}
+	return n
+}
+
+// provenance sets up the soup's and runners' provenance, if wanted. It
+// panics if the ISA can't trace its runs.
+func (s *Soup) provenance() {
+	if !s.Config.Provenance {
+		return
+	}
+	if _, ok := s.ISA.(Tracer); !ok {
+		panic(fmt.Sprintf("%T can't trace provenance", s.ISA))
+	}
+	s.prov = &provenance{tags: make([]Tag, len(s.Universe))}
+	for i := range s.prov.tags {
+		s.prov.tags[i].Src = -1
+	}
+	s.lineage = make(map[uint64]*Node)
+	for i, r := range s.runners {
+		r.prov = &provenance{tags: s.prov.tags, next: uint64(i) + 1, stride: uint64(len(s.runners))}
+		if s.epochs() {
+			r.prov.tags = make([]Tag, len(s.Universe))
+		}
+	}
+	if s.epochs() {
+		s.base_tags = make([]Tag, len(s.Universe))
+	}
+}
+
+// adopt adds r's runs to the lineage graph, and prunes the graph if it has
+// grown. Call with mu held.
+func (s *Soup) adopt(r *Runner) {
+	for _, n := range r.prov.nodes {
+		n.Generation = s.Generation()
+		s.lineage[n.Run] = n
+	}
+	r.prov.nodes = r.prov.nodes[:0]
+	if len(s.lineage) > 2*s.live+len(s.Universe) {
+		s.prune()
+	}
+}
+
+// mergeTags commits a runner's view of the tags, like merge.
+func mergeTags(tags []Tag, base []Tag, view []Tag) {
+	for i := range tags {
+		if view[i] != base[i] {
+			tags[i] = view[i]
+		}
+	}
+}
+
+// prune drops the runs no cell descends from, or only from further back
+// than Config.LineageDepth. Call with mu held.
+func (s *Soup) prune() {
+	live := make(map[uint64]bool)
+	var runs []uint64
+	for _, t := range s.prov.tags {
+		if !live[t.Run] {
+			live[t.Run] = true
+			runs = append(runs, t.Run)
+		}
+	}
+	for d := 1; d < s.Config.LineageDepth && len(runs) > 0; d++ {
+		var parents []uint64
+		for _, run := range runs {
+			n := s.lineage[run]
+			if n == nil {
+				continue
+			}
+			for _, e := range n.Parents {
+				if !live[e.Run] {
+					live[e.Run] = true
+					parents = append(parents, e.Run)
+				}
+			}
+		}
+		runs = parents
+	}
+	for run := range s.lineage {
+		if !live[run] {
+			delete(s.lineage, run)
+		}
+	}
+	s.live = len(s.lineage)
+}
+
+// CellTag is a cell's tag.
+type CellTag struct {
+	Cell int `json:"cell"`
+	Tag
+}
+
+// Lineage is the ancestry of some cells: the runs that wrote them, the runs
+// those copied from, and so on.
+type Lineage struct {
+	Generation uint64    `json:"generation"`
+	Cells      []CellTag `json:"cells"`
+	Nodes      []*Node   `json:"nodes"` // In order of run
+}
+
+// Lineage returns the ancestry of cells, going back at most depth runs, or
+// nil if provenance isn't on.
+func (s *Soup) Lineage(cells []int, depth int) *Lineage {
+	if s.prov == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l := &Lineage{Generation: s.Generation()}
+	seen := make(map[uint64]bool)
+	var runs []uint64
+	for _, c := range cells {
+		t := s.prov.tags[c]
+		l.Cells = append(l.Cells, CellTag{Cell: c, Tag: t})
+		if !seen[t.Run] {
+			seen[t.Run] = true
+			runs = append(runs, t.Run)
+		}
+	}
+	for d := 0; d < depth && len(runs) > 0; d++ {
+		var parents []uint64
+		for _, run := range runs {
+			n := s.lineage[run]
+			if n == nil {
+				continue
+			}
+			l.Nodes = append(l.Nodes, n)
+			for _, e := range n.Parents {
+				if !seen[e.Run] {
+					seen[e.Run] = true
+					parents = append(parents, e.Run)
+				}
+			}
+		}
+		runs = parents
+	}
+	sort.Slice(l.Nodes, func(i, j int) bool {
+		return l.Nodes[i].Run < l.Nodes[j].Run
+	})
+	return l
+}
+
+// WriteDOT writes the lineage as a Graphviz graph, with an edge from each
+// run to the runs that copied from it. The runs that wrote the cells are
+// filled in.
+func (l *Lineage) WriteDOT(w io.Writer) error {
+	wrote := make(map[uint64]int)
+	for _, c := range l.Cells {
+		wrote[c.Run]++
+	}
+	fmt.Fprintf(w, "digraph lineage {\n\tlabel=\"generation %d\"\n", l.Generation)
+	fmt.Fprintf(w, "\tr0 [label=\"initial or mutated\" shape=box]\n")
+	for _, n := range l.Nodes {
+		style := ""
+		if wrote[n.Run] != 0 {
+			style = fmt.Sprintf(" style=filled xlabel=\"%d cells\"", wrote[n.Run])
+		}
+		fmt.Fprintf(w, "\tr%d [label=\"run %d\\ngeneration %d\\n%d writes, %d copied\"%s]\n", n.Run, n.Run, n.Generation, n.Cells, n.Copied, style)
+		for _, e := range n.Parents {
+			fmt.Fprintf(w, "\tr%d -> r%d [label=\"%d\"]\n", e.Run, n.Run, e.Cells)
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteLineage writes the lineage of the most common replicator, see
+// Census, or of the whole universe if there isn't one, to name: as DOT if
+// it ends in .dot and JSON otherwise.
+func (s *Soup) WriteLineage(name string) error {
+	if s.prov == nil {
+		return fmt.Errorf("no provenance to write to %s, use -provenance", name)
+	}
+	u := make(Universe, len(s.Universe))
+	s.Snapshot(u)
+	var cells []int
+	if c := u.Census(16, 256, 1); len(c) > 0 {
+		for _, p := range c[0].Positions {
+			for k := range c[0].Seq {
+				cells = append(cells, (p+k)%len(u))
+			}
+		}
+	} else {
+		for i := range u {
+			cells = append(cells, i)
+		}
+	}
+	l := s.Lineage(cells, s.Config.LineageDepth)
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, ".dot") {
+		err = l.WriteDOT(f)
+	} else {
+		err = json.NewEncoder(f).Encode(l)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
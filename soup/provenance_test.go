@@ -0,0 +1,32 @@
+package soup
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func tracing(c *Config) { c.Provenance = true }
+
+func TestProvenance(t *testing.T) {
+	for _, schedule := range []string{PARALLEL, ROUND_ROBIN} {
+		s := ran(copier{}, scheduling(schedule), tracing)
+		for i, tag := range s.prov.tags {
+			if tag.Run == 0 {
+				continue
+			}
+			n := s.lineage[tag.Run]
+			assert.Assert(t, n != nil, "cell %d was written by run %d", i, tag.Run)
+			assert.Assert(t, tag.Src >= 0)
+			assert.Equal(t, n.Cells, 1)
+		}
+
+		l := s.Lineage([]int{0, 1, 2}, 8)
+		assert.Equal(t, len(l.Cells), 3)
+		var b strings.Builder
+		assert.NilError(t, l.WriteDOT(&b))
+		assert.Assert(t, strings.HasPrefix(b.String(), "digraph lineage {"))
+	}
+	assert.DeepEqual(t, ran(copier{}, tracing).prov.tags, ran(copier{}, scheduling(SERIAL), tracing).prov.tags)
+}
@@ -0,0 +1,449 @@
+package soup
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Legacy layouts, see LogHeader.Legacy.
+const (
+	LEGACY_F3 = "f3" // generation, universe
+	LEGACY_F5 = "f5" // generation, n_ops, universe
+)
+
+// Frame is one snapshot from a log.
+type Frame struct {
+	Generation uint64
+	NOps       uint64
+	Universe   Universe
+	Fields     map[string][]byte // Any others, by name, as raw bytes
+}
+
+// LogReader reads frames from a log. It can only seek, with Index and
+// SeekGeneration, if it was made from an io.ReadSeeker.
+type LogReader struct {
+	Header LogHeader
+
+	r     io.Reader
+	rs    io.ReadSeeker
+	br    *bufio.Reader // Version 2 records
+	base  int64         // Offset of the first frame
+	buf   []byte
+	prev  []byte
+	z     io.ReadCloser
+	index []IndexEntry
+}
+
+// OpenLog opens a log for reading, see NewLogReader.
+func OpenLog(name string) (*LogReader, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := NewLogReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return l, f, nil
+}
+
+// ReadFrame reads the header of the log name and its first frame at or
+// after generation.
+func ReadFrame(name string, generation uint64) (*LogHeader, *Frame, error) {
+	l, f, err := OpenLog(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if err := l.SeekGeneration(generation); err != nil {
+		return nil, nil, err
+	}
+	fr, err := l.Next()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("no frame at or after generation %d", generation)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &l.Header, fr, nil
+}
+
+// NewLogReader reads the header of a log of any version. Legacy logs don't
+// say whether their frames have n_ops, so the layout is guessed from
+// whichever gives plausible generations; use NewLegacyLogReader if you know.
+func NewLogReader(r io.ReadSeeker) (*LogReader, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) == LOG_MAGIC {
+		return readHeader(r)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	words := make([]uint64, 5)
+	if err := binary.Read(r, binary.LittleEndian, words); err != nil {
+		return nil, err
+	}
+	ulen := int64(words[0])
+	layout := LEGACY_F5
+	if !plausible(r, ulen+16, 16) && plausible(r, ulen+8, 8) {
+		layout = LEGACY_F3
+	}
+	if _, err := r.Seek(40, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return NewLegacyLogReader(r, layout, words)
+}
+
+// plausible reports whether the first few frames of size n, with the
+// universe at offset off, have sensible generations and op counts. Read at
+// the wrong offset they come from universe cells and are nonsense.
+func plausible(r io.ReadSeeker, n int64, off int64) bool {
+	prev := uint64(0)
+	for i := int64(0); i < 4; i++ {
+		if _, err := r.Seek(40+i*n, io.SeekStart); err != nil {
+			return false
+		}
+		var w [2]uint64
+		err := binary.Read(r, binary.LittleEndian, w[:off/8])
+		if err != nil {
+			return i > 0
+		}
+		if w[0] < prev || w[0] > 1<<48 || (off == 16 && (w[1] < w[0] || w[1] > 1<<56)) {
+			return false
+		}
+		prev = w[0]
+	}
+	return true
+}
+
+// NewLegacyLogReader reads a legacy log with the given layout. words is the
+// five word header, or nil to read it from r.
+func NewLegacyLogReader(r io.Reader, layout string, words []uint64) (*LogReader, error) {
+	if words == nil {
+		words = make([]uint64, 5)
+		if err := binary.Read(r, binary.LittleEndian, words); err != nil {
+			return nil, err
+		}
+	}
+	h := LogHeader{
+		Legacy: layout,
+		Params: map[string]any{
+			"ulen":          float64(words[0]),
+			"slen":          float64(words[1]),
+			"ilimit":        float64(words[2]),
+			"mutation_rate": float64(words[3]),
+			"runners":       float64(words[4]),
+		},
+		Frame: []Field{{Name: "generation", Type: U64}},
+	}
+	switch layout {
+	case LEGACY_F3:
+	case LEGACY_F5:
+		h.Frame = append(h.Frame, Field{Name: "n_ops", Type: U64})
+	default:
+		return nil, fmt.Errorf("unknown legacy layout %q", layout)
+	}
+	h.Frame = append(h.Frame, Field{Name: "universe", Type: U8, Len: int(words[0])})
+	return newLogReader(r, h)
+}
+
+func readHeader(r io.Reader) (*LogReader, error) {
+	var v [2]uint32
+	if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+		return nil, err
+	}
+	if v[0] != LOG_VERSION {
+		return nil, fmt.Errorf("log version %d isn't %d", v[0], LOG_VERSION)
+	}
+	j := make([]byte, v[1])
+	if _, err := io.ReadFull(r, j); err != nil {
+		return nil, err
+	}
+	var h LogHeader
+	if err := json.Unmarshal(j, &h); err != nil {
+		return nil, err
+	}
+	h.Version = int(v[0])
+	for _, f := range h.Frame {
+		if f.Type != U8 && f.Type != U64 {
+			return nil, fmt.Errorf("field %s has unknown type %q", f.Name, f.Type)
+		}
+	}
+	if h.Encoding == nil || h.Encoding.Codec != "flate" {
+		return nil, errors.New("log has no known encoding")
+	}
+	return newLogReader(r, h)
+}
+
+func newLogReader(r io.Reader, h LogHeader) (*LogReader, error) {
+	l := &LogReader{Header: h, r: r, buf: make([]byte, h.frameSize())}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		base, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		l.rs = rs
+		l.base = base
+	}
+	if l.records() {
+		l.br = bufio.NewReader(r)
+	}
+	return l, nil
+}
+
+// records reports whether frames are stored as records, as they are in all
+// but legacy logs.
+func (l *LogReader) records() bool {
+	return l.Header.Legacy == ""
+}
+
+// Next reads the next frame. It returns io.EOF at the end of the log,
+// including when the last frame was cut short.
+func (l *LogReader) Next() (*Frame, error) {
+	var err error
+	if l.records() {
+		err = l.readRecord()
+	} else {
+		_, err = io.ReadFull(l.r, l.buf)
+	}
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	fr := &Frame{}
+	b := l.buf
+	for _, f := range l.Header.Frame {
+		n := f.size()
+		switch {
+		case f.Name == "generation" && f.Type == U64:
+			fr.Generation = binary.LittleEndian.Uint64(b)
+		case f.Name == "n_ops" && f.Type == U64:
+			fr.NOps = binary.LittleEndian.Uint64(b)
+		case f.Name == "universe" && f.Type == U8:
+			fr.Universe = make(Universe, n)
+			copy(fr.Universe, b)
+		default:
+			if fr.Fields == nil {
+				fr.Fields = make(map[string][]byte)
+			}
+			fr.Fields[f.Name] = append([]byte{}, b[:n]...)
+		}
+		b = b[n:]
+	}
+	return fr, nil
+}
+
+// readRecord decodes the next record into buf.
+func (l *LogReader) readRecord() error {
+	var h [RECORD_HEADER_LEN]byte
+	if _, err := io.ReadFull(l.br, h[:]); err != nil {
+		return err
+	}
+	kind := h[0]
+	if kind == INDEX {
+		return io.EOF
+	}
+	if kind != KEYFRAME && kind != DELTA {
+		return fmt.Errorf("unknown record kind %d", kind)
+	}
+	if kind == DELTA && l.prev == nil {
+		return errors.New("delta without a keyframe")
+	}
+
+	payload := io.LimitReader(l.br, int64(binary.LittleEndian.Uint32(h[9:])))
+	if l.z == nil {
+		l.z = flate.NewReader(payload)
+	} else {
+		l.z.(flate.Resetter).Reset(payload, nil)
+	}
+	if _, err := io.ReadFull(l.z, l.buf); err != nil {
+		return err
+	}
+	// Consume the rest of the compressed stream so the next record lines up
+	io.Copy(io.Discard, payload)
+
+	if kind == DELTA {
+		for i := range l.buf {
+			l.buf[i] ^= l.prev[i]
+		}
+	}
+	l.prev = append(l.prev[:0], l.buf...)
+	return nil
+}
+
+// Index returns the location of every frame in the log. It is read from the
+// end of the log, or if the writer didn't get to write it by scanning the
+// records. Legacy logs are scanned frame by frame.
+func (l *LogReader) Index() ([]IndexEntry, error) {
+	if l.index != nil {
+		return l.index, nil
+	}
+	if l.rs == nil {
+		return nil, errors.New("log is not seekable")
+	}
+	pos, err := l.rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if l.records() {
+		l.index, err = l.readIndex()
+		if err != nil {
+			l.index, err = l.scanRecords()
+		}
+	} else {
+		l.index, err = l.scanFrames()
+	}
+	if _, err := l.rs.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return l.index, err
+}
+
+// readIndex reads the index written by Logger.Close.
+func (l *LogReader) readIndex() ([]IndexEntry, error) {
+	end, err := l.rs.Seek(-16, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var t [16]byte
+	if _, err := io.ReadFull(l.rs, t[:]); err != nil {
+		return nil, err
+	}
+	if string(t[8:]) != INDEX_MAGIC {
+		return nil, errors.New("log has no index")
+	}
+	off := int64(binary.LittleEndian.Uint64(t[:]))
+	if _, err := l.rs.Seek(off+RECORD_HEADER_LEN, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(flate.NewReader(io.LimitReader(l.rs, end-off-RECORD_HEADER_LEN)))
+	if err != nil {
+		return nil, err
+	}
+	index := make([]IndexEntry, 0, len(b)/17)
+	for ; len(b) >= 17; b = b[17:] {
+		index = append(index, IndexEntry{
+			Generation: binary.LittleEndian.Uint64(b),
+			Offset:     int64(binary.LittleEndian.Uint64(b[8:])),
+			Kind:       b[16],
+		})
+	}
+	return index, nil
+}
+
+// scanRecords builds the index by hopping from record header to record
+// header, stopping at the first incomplete record.
+func (l *LogReader) scanRecords() ([]IndexEntry, error) {
+	index := []IndexEntry{}
+	for off := l.base; ; {
+		if _, err := l.rs.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var h [RECORD_HEADER_LEN]byte
+		if _, err := io.ReadFull(l.rs, h[:]); err != nil || h[0] == INDEX {
+			return index, nil
+		}
+		n := int64(binary.LittleEndian.Uint32(h[9:]))
+		next, err := l.rs.Seek(n, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		end, err := l.rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if next > end {
+			return index, nil
+		}
+		index = append(index, IndexEntry{Generation: binary.LittleEndian.Uint64(h[1:]), Offset: off, Kind: h[0]})
+		off = next
+	}
+}
+
+// scanFrames builds the index of a log of fixed size frames.
+func (l *LogReader) scanFrames() ([]IndexEntry, error) {
+	g := -1
+	off := 0
+	for _, f := range l.Header.Frame {
+		if f.Name == "generation" && f.Type == U64 {
+			g = off
+		}
+		off += f.size()
+	}
+	if g < 0 {
+		return nil, errors.New("log frames have no generation")
+	}
+	size := int64(l.Header.frameSize())
+	end, err := l.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	index := []IndexEntry{}
+	for off := l.base; off+size <= end; off += size {
+		if _, err := l.rs.Seek(off+int64(g), io.SeekStart); err != nil {
+			return nil, err
+		}
+		var generation uint64
+		if err := binary.Read(l.rs, binary.LittleEndian, &generation); err != nil {
+			return nil, err
+		}
+		index = append(index, IndexEntry{Generation: generation, Offset: off, Kind: KEYFRAME})
+	}
+	return index, nil
+}
+
+// SeekGeneration positions the reader so that Next returns the first frame
+// at or after generation. It decodes forward from the keyframe before it.
+func (l *LogReader) SeekGeneration(generation uint64) error {
+	index, err := l.Index()
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].Generation >= generation
+	})
+	if i == len(index) {
+		if _, err := l.rs.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		l.reset()
+		return nil
+	}
+	k := i
+	for k > 0 && index[k].Kind != KEYFRAME {
+		k--
+	}
+	if _, err := l.rs.Seek(index[k].Offset, io.SeekStart); err != nil {
+		return err
+	}
+	l.reset()
+	for ; k < i; k++ {
+		if _, err := l.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset discards any state from before a seek.
+func (l *LogReader) reset() {
+	l.prev = nil
+	if l.br != nil {
+		l.br.Reset(l.rs)
+	}
+}
@@ -0,0 +1,455 @@
+package soup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pgregory.net/rand"
+)
+
+/*
+Concurrency
+
+Runners never share memory while they run. In the parallel and serial
+schedules time is divided into epochs. At the start of an epoch every runner
+copies the shared universe into its own view, then does Config.Epoch runs
+(including mutations) against that view alone. When all runners have
+finished, their changes - the cells where a view differs from the universe
+the epoch started with - are committed to the shared universe in runner
+order, so if two runners wrote the same cell the higher numbered one wins.
+Runners do not see each other's writes until the next epoch.
+
+The result depends only on the seed and the configuration, not on how the
+goroutines happen to be scheduled, so a parallel run produces exactly the
+same universes as the same epochs run one at a time in the serial schedule.
+
+The round-robin and random schedules have no epochs: runners take turns,
+one run at a time, directly on the shared universe.
+
+Each runner counts its own runs and ops, and adds them to the soup's atomic
+totals when its changes are committed. The shared universe and the totals
+only change under Soup.mu, so Snapshot always sees a universe together with
+the generation and op count that produced it.
+*/
+
+// Runner repeatedly runs the program at a random pc, mutating the universe
+// as it goes. Each runner has its own random stream.
+type Runner struct {
+	ISA          ISA
+	Universe     Universe // The shared universe, or the runner's view of it
+	Rand         *rand.Rand
+	MutationRate int  // Higher is less mutation, 0 is none
+	PerOp        bool // MutationRate counts ops rather than runs
+
+	// Runs and ops not yet added to the soup's totals.
+	Generation uint64
+	NOps       uint64
+
+	t    int         // ops since the last mutation
+	prov *provenance // May be nil
+	prof *Profile    // Runs not yet added to the soup's profile, may be nil
+}
+
+// Step does a single run.
+func (r *Runner) Step() {
+	pc := r.Rand.Intn(len(r.Universe))
+	var n int
+	if r.prov != nil {
+		n = r.prov.run(r, pc)
+	} else {
+		n = r.run(pc, nil)
+	}
+	r.NOps += uint64(n)
+	if r.MutationRate == 0 {
+		// No mutation
+	} else if r.PerOp {
+		r.t += n
+		for r.t > r.MutationRate {
+			r.mutate()
+			r.t -= r.MutationRate
+		}
+	} else if r.Rand.Intn(r.MutationRate) == 0 {
+		r.mutate()
+	}
+	r.Generation++
+}
+
+// run runs the program at pc, tracing its writes if wrote isn't nil and
+// profiling it if wanted.
+func (r *Runner) run(pc int, wrote func(dst int, src int)) int {
+	if r.prof != nil {
+		n := r.ISA.(Profiler).RunProfiled(r.Universe, pc, wrote, r.prof)
+		r.prof.Ran(n)
+		return n
+	}
+	if wrote != nil {
+		return r.ISA.(Tracer).RunTraced(r.Universe, pc, wrote)
+	}
+	return r.ISA.Run(r.Universe, pc)
+}
+
+// mutate is Universe.Mutate, clearing the cell's tag.
+func (r *Runner) mutate() {
+	if r.prov == nil {
+		r.Universe.Mutate(r.ISA, r.Rand)
+		return
+	}
+	i := r.Rand.Intn(len(r.Universe))
+	r.Universe[i] = r.ISA.RandomOp(r.Rand)
+	r.prov.tags[i] = Tag{Src: -1}
+}
+
+// Soup drives a universe with a number of runners and displays it.
+type Soup struct {
+	ISA      ISA
+	Universe Universe // Only touch this with Snapshot once runners start
+	Config   *Config
+	Rand     *rand.Rand // For initialising the universe
+	PerOp    bool
+	Log      *Logger // May be nil
+
+	Assemble func(src io.Reader) ([]uint8, error) // For injecting .s files, may be nil
+
+	Scroll bool // Display a different part of the universe each time
+	Kmers  bool // Display the most common k-mers
+
+	mu         sync.RWMutex
+	generation atomic.Uint64
+	n_ops      atomic.Uint64
+	base       Universe // The universe at the start of the epoch
+
+	prov      *provenance // May be nil
+	base_tags []Tag
+	lineage   map[uint64]*Node
+	live      int // Nodes left by the last prune
+
+	prof *Profile // May be nil
+
+	runners     []*Runner
+	sched       *rand.Rand // Picks runners in the random schedule
+	step        int        // Runs so far in the round-robin and random schedules
+	checkpoint  atomic.Bool
+	emerged     atomic.Bool            // Checkpoint for emergence wanted
+	stop        atomic.Pointer[string] // Why the run is stopping
+	done        chan struct{}
+	started     time.Time // When this process started running the soup
+	start_gen   uint64
+	start_n_ops uint64
+	show_off    int
+	kmers       KmerCounter
+
+	stats        *StatsWriter // May be nil
+	stats_mu     sync.Mutex
+	p_time       time.Time
+	p_generation uint64
+	p_n_ops      uint64
+	p_profile    Profile
+	detector     detector
+}
+
+// NewSoup makes a soup with a universe of c.ULen cells. All its random
+// numbers are derived from c.Seed.
+func NewSoup(isa ISA, c *Config) *Soup {
+	return &Soup{
+		ISA:      isa,
+		Universe: make(Universe, c.ULen),
+		Config:   c,
+		Rand:     rand.New(c.Seed),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *Soup) Generation() uint64 {
+	return s.generation.Load()
+}
+
+func (s *Soup) NOps() uint64 {
+	return s.n_ops.Load()
+}
+
+func (s *Soup) epochs() bool {
+	return s.Config.Schedule != ROUND_ROBIN && s.Config.Schedule != RANDOM
+}
+
+// Runners returns the soup's Config.Runners runners, runner i drawing from
+// the stream seeded by (Seed, i).
+func (s *Soup) Runners() []*Runner {
+	if s.runners != nil {
+		return s.runners
+	}
+	if _, ok := s.ISA.(Fielder); ok && s.epochs() {
+		panic(fmt.Sprintf("%T has state beside the universe, so needs the round-robin or random schedule", s.ISA))
+	}
+	for i := 0; i < s.Config.Runners; i++ {
+		r := &Runner{
+			ISA:          s.ISA,
+			Universe:     s.Universe,
+			Rand:         rand.New(s.Config.Seed, uint64(i)),
+			MutationRate: s.Config.MutationRate,
+			PerOp:        s.PerOp,
+		}
+		if s.epochs() {
+			r.Universe = make(Universe, len(s.Universe))
+		}
+		s.runners = append(s.runners, r)
+	}
+	s.provenance()
+	s.profile()
+	return s.runners
+}
+
+// Start runs the runners in the background, see Schedule. If the run is
+// resuming a checkpoint the soup is restored from it first, replacing
+// whatever the universe was initialised with.
+//
+// The run goes on until a limit in the Config is reached, Stop is called or
+// the process is interrupted, and then the soup is finished off, see Done.
+func (s *Soup) Start() {
+	if c := s.Config.checkpoint; c != nil {
+		if err := s.Restore(c); err != nil {
+			panic(err)
+		}
+	} else if err := s.Inject(os.Stderr); err != nil {
+		panic(err)
+	}
+	if s.Config.StatsOut != "" {
+		w, err := NewStatsWriter(s.Config.StatsOut, s.Config.Profile)
+		if err != nil {
+			panic(err)
+		}
+		s.stats = w
+	}
+	s.checkpointOnSignal()
+	s.stopOnSignal()
+	s.Runners()
+	go func() {
+		s.Schedule(0)
+		s.finish()
+	}()
+}
+
+// Schedule runs the runners until the generation reaches generations, or
+// forever if that is 0, or until the run is stopped. Epochs are only
+// committed whole, so it may overshoot.
+//
+// In the parallel schedule each runner does its share of an epoch on its
+// own goroutine; in the serial schedule they take turns on the calling
+// goroutine. Both give the same result.
+//
+// In the round-robin schedule runners take turns one run at a time, in the
+// random schedule they are picked by a random stream seeded by (Seed,
+// Runners).
+//
+// If Config.LogEvery is set a frame is logged whenever the generation passes
+// a multiple of it, and likewise a checkpoint for Config.CheckpointEvery.
+// Between runs or epochs the runners are idle, so that is when checkpoints
+// asked for by RequestCheckpoint, or on emergence, are taken.
+func (s *Soup) Schedule(generations uint64) {
+	runners := s.Runners()
+	if s.sched == nil {
+		s.sched = rand.New(s.Config.Seed, uint64(len(runners)))
+	}
+	if s.epochs() {
+		s.base = make(Universe, len(s.Universe))
+		copy(s.base, s.Universe)
+		if s.prov != nil {
+			copy(s.base_tags, s.prov.tags)
+		}
+	}
+	if s.started.IsZero() {
+		s.started = time.Now()
+		s.start_gen, s.start_n_ops = s.Generation(), s.NOps()
+	}
+	for (generations == 0 || s.Generation() < generations) && !s.stopping() {
+		prev := s.Generation()
+		switch s.Config.Schedule {
+		case ROUND_ROBIN, RANDOM:
+			r := runners[s.step%len(runners)]
+			if s.Config.Schedule == RANDOM {
+				r = runners[s.sched.Intn(len(runners))]
+			}
+			s.step++
+			s.mu.Lock()
+			r.Step()
+			s.publish(r)
+			if s.prov != nil {
+				s.adopt(r)
+			}
+			s.mu.Unlock()
+		case SERIAL:
+			for _, r := range runners {
+				s.epoch(r)
+			}
+			s.commit()
+		default:
+			var wg sync.WaitGroup
+			for _, r := range runners {
+				wg.Add(1)
+				go func(r *Runner) {
+					s.epoch(r)
+					wg.Done()
+				}(r)
+			}
+			wg.Wait()
+			s.commit()
+		}
+		if s.Log != nil && passed(prev, s.Generation(), s.Config.LogEvery) {
+			s.mu.RLock()
+			s.Log.DumpFields(s.Generation(), s.NOps(), s.Universe, s.fieldValues()...)
+			s.mu.RUnlock()
+		}
+		if s.checkpoint.Swap(false) || passed(prev, s.Generation(), s.Config.CheckpointEvery) {
+			if err := s.WriteCheckpoint(); err != nil {
+				fmt.Fprintln(os.Stderr, "checkpoint:", err)
+			}
+		}
+		if s.emerged.Swap(false) {
+			if err := s.SaveCheckpoint(s.EmergenceName()); err != nil {
+				fmt.Fprintln(os.Stderr, "checkpoint:", err)
+			}
+		}
+	}
+}
+
+// passed reports whether going from generation prev to g passed a multiple
+// of every, which is never if every is 0.
+func passed(prev uint64, g uint64, every uint64) bool {
+	return every != 0 && prev/every != g/every
+}
+
+// epoch does one runner's share of an epoch. The shared universe does not
+// change during an epoch, so base can be read without the lock.
+func (s *Soup) epoch(r *Runner) {
+	copy(r.Universe, s.base)
+	if r.prov != nil {
+		copy(r.prov.tags, s.base_tags)
+	}
+	for i := 0; i < s.Config.Epoch; i++ {
+		r.Step()
+	}
+}
+
+func (s *Soup) commit() {
+	s.mu.Lock()
+	for _, r := range s.runners {
+		merge(s.Universe, s.base, r.Universe)
+		s.publish(r)
+		if s.prov != nil {
+			mergeTags(s.prov.tags, s.base_tags, r.prov.tags)
+			s.adopt(r)
+		}
+	}
+	s.mu.Unlock()
+	copy(s.base, s.Universe)
+	if s.prov != nil {
+		copy(s.base_tags, s.prov.tags)
+	}
+}
+
+// merge copies the cells where view differs from base into u.
+func merge(u Universe, base Universe, view Universe) {
+	i := 0
+	for ; i+8 <= len(u); i += 8 {
+		if binary.LittleEndian.Uint64(view[i:]) == binary.LittleEndian.Uint64(base[i:]) {
+			continue
+		}
+		for j := i; j < i+8; j++ {
+			if view[j] != base[j] {
+				u[j] = view[j]
+			}
+		}
+	}
+	for ; i < len(u); i++ {
+		if view[i] != base[i] {
+			u[i] = view[i]
+		}
+	}
+}
+
+// publish adds r's counts to the totals. Call with mu held.
+func (s *Soup) publish(r *Runner) {
+	s.generation.Add(r.Generation)
+	s.n_ops.Add(r.NOps)
+	r.Generation = 0
+	r.NOps = 0
+	if r.prof != nil {
+		s.prof.Add(r.prof)
+		*r.prof = Profile{}
+	}
+}
+
+// Snapshot copies the universe into u, which must be the same length, and
+// returns the generation and op count it corresponds to.
+func (s *Soup) Snapshot(u Universe) (generation uint64, n_ops uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	copy(u, s.Universe)
+	return s.Generation(), s.NOps()
+}
+
+// SnapshotFields is Snapshot, also returning the values of the ISA's
+// fields if it is a Fielder.
+func (s *Soup) SnapshotFields(u Universe) (generation uint64, n_ops uint64, values [][]byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	copy(u, s.Universe)
+	return s.Generation(), s.NOps(), s.fieldValues()
+}
+
+// fieldValues returns the values of the ISA's fields, or nil if it isn't a
+// Fielder. Call with mu held, or the runners stopped.
+func (s *Soup) fieldValues() [][]byte {
+	if f, ok := s.ISA.(Fielder); ok {
+		return f.FieldValues()
+	}
+	return nil
+}
+
+// Status logs a snapshot of the universe, samples its stats and displays
+// it, unless Config.Quiet.
+func (s *Soup) Status() {
+	u2 := make(Universe, len(s.Universe))
+	generation, n_ops, values := s.SnapshotFields(u2)
+	if s.Log != nil && s.Config.LogEvery == 0 {
+		s.Log.DumpFields(generation, n_ops, u2, values...)
+	}
+	st := s.Sample(u2, generation, n_ops)
+	if s.Config.Quiet {
+		return
+	}
+	fmt.Println("\033c", generation, n_ops, st.Generations, st.Ops, uint64(st.OpsPerRun))
+	if st.Profile != nil {
+		fmt.Println(st.Profile)
+	}
+
+	if s.Scroll {
+		s.show_off += s.Config.ShowLen
+	}
+	if s.show_off >= len(u2) {
+		s.show_off -= len(u2)
+	}
+	u2.Show(s.ISA, s.show_off, s.Config.ShowLen)
+	if s.Kmers {
+		for k := 2; k < 16; k++ {
+			s.kmers.Show(u2, s.ISA.Glyph, k, s.Config.KmerDelta)
+			fmt.Print("\n")
+		}
+	}
+}
+
+// Monitor calls Status once a second until the soup is done.
+func (s *Soup) Monitor() {
+	for {
+		s.Status()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package soup
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+func (s *Soup) checkpointOnSignal() {}
+
+func (s *Soup) stopOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		sig := <-c
+		signal.Stop(c)
+		fmt.Fprintln(os.Stderr, "stopping on", sig)
+		s.Stop(sig.String())
+	}()
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package soup
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// checkpointOnSignal takes a checkpoint whenever the process gets SIGUSR1.
+func (s *Soup) checkpointOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			s.RequestCheckpoint()
+		}
+	}()
+}
+
+// stopOnSignal stops the run cleanly on SIGINT or SIGTERM. A second one
+// kills the process as usual.
+func (s *Soup) stopOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		signal.Stop(c)
+		fmt.Fprintln(os.Stderr, "stopping on", sig)
+		s.Stop(sig.String())
+	}()
+}
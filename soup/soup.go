@@ -0,0 +1,151 @@
+// Package soup is the engine shared by the circular-universe experiments
+// (f2, f3, f5, f6, bfsoup). Each experiment supplies an ISA; the soup
+// supplies the universe, the runners that execute it, mutation, logging and
+// the terminal display.
+package soup
+
+import (
+	"compress/flate"
+	"fmt"
+	"math"
+
+	"pgregory.net/rand"
+)
+
+// ISA is an instruction set that can be run in a universe.
+type ISA interface {
+	// Run executes the program at pc until it halts and returns the number
+	// of iterations it took.
+	Run(universe []uint8, pc int) int
+	// Glyph is the single character used to display op.
+	Glyph(op uint8) string
+	// RandomOp returns an op for mutation and random initialisation.
+	RandomOp(r *rand.Rand) uint8
+}
+
+// Tracer is an ISA that can say which cells a run writes, for provenance.
+type Tracer interface {
+	// RunTraced is Run, calling wrote(dst, src) whenever the program writes
+	// cell dst: src is the cell the value was copied from, or -1 if it was
+	// computed.
+	RunTraced(universe []uint8, pc int, wrote func(dst int, src int)) int
+}
+
+// Fielder is an ISA whose runs change state of its own beside the
+// universe, such as f7's juice. A soup logs the state in each frame as
+// fields after the universe, and checkpoints it. The runs must take turns
+// on the shared universe, so it needs the round-robin or random schedule.
+type Fielder interface {
+	// Fields describes the state, for NewFieldLogger.
+	Fields() []Field
+	// FieldValues returns a copy of each field's value, as DumpFields takes
+	// them.
+	FieldValues() [][]byte
+	// SetFieldValues puts back values FieldValues returned.
+	SetFieldValues(values [][]byte) error
+}
+
+// Universe is the circular memory shared by all programs.
+type Universe []uint8
+
+func Pmod(a int, b int) int {
+	return (a%b + b) % b
+}
+
+func SignExtend(a uint8) int8 {
+	if a&0x08 == 0x08 {
+		return int8(a - 0x10)
+	}
+	return int8(a)
+}
+
+// Fill sets every cell to op.
+func (u Universe) Fill(op uint8) {
+	for i := range u {
+		u[i] = op
+	}
+}
+
+// Randomize sets every cell to a random op.
+func (u Universe) Randomize(isa ISA, r *rand.Rand) {
+	for i := range u {
+		u[i] = isa.RandomOp(r)
+	}
+}
+
+func (u Universe) Mutate(isa ISA, r *rand.Rand) {
+	u[r.Intn(len(u))] = isa.RandomOp(r)
+}
+
+// Show prints n cells starting at off, 128 to a line.
+func (u Universe) Show(isa ISA, off int, n int) {
+	for i := 0; i < n; i++ {
+		fmt.Print(isa.Glyph(u[(i+off)%len(u)]))
+		if i%128 == 127 {
+			fmt.Print("\n")
+		}
+	}
+}
+
+// Histogram counts the cells holding each op.
+func (u Universe) Histogram() [256]int {
+	var h [256]int
+	for _, op := range u {
+		h[op]++
+	}
+	return h
+}
+
+// Entropy is the Shannon entropy of the ops in u, in bits per cell.
+func (u Universe) Entropy() float64 {
+	return Entropy(u.Histogram(), len(u))
+}
+
+// Entropy is the Shannon entropy, in bits, of a histogram of n things.
+func Entropy(h [256]int, n int) float64 {
+	e := 0.0
+	for _, c := range h {
+		if c != 0 {
+			p := float64(c) / float64(n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// CompressedBits is the size of u compressed with flate, in bits per cell.
+// It estimates the information in u allowing for repeated sequences, where
+// Entropy only sees the frequency of each op. f5stats.py used brotli, which
+// compresses a little harder.
+func (u Universe) CompressedBits() float64 {
+	var n counter
+	z, _ := flate.NewWriter(&n, flate.BestCompression)
+	z.Write(u)
+	z.Close()
+	return float64(n) / float64(len(u)) * 8
+}
+
+// HighOrderEntropy is Entropy less CompressedBits: how much of the apparent
+// randomness of the ops is explained by their order. It jumps when
+// replicators take over.
+func (u Universe) HighOrderEntropy() float64 {
+	return u.Entropy() - u.CompressedBits()
+}
+
+// Changes counts the cells that differ between a and b.
+func Changes(a Universe, b Universe) int {
+	c := 0
+	for i := range a {
+		if a[i] != b[i] {
+			c++
+		}
+	}
+	return c
+}
+
+type counter int
+
+func (c *counter) Write(b []byte) (int, error) {
+	*c += counter(len(b))
+	return len(b), nil
+}
@@ -0,0 +1,281 @@
+package soup
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"pgregory.net/rand"
+)
+
+type glyphs struct{}
+
+func (glyphs) Run(universe []uint8, pc int) int { return 1 }
+func (glyphs) Glyph(op uint8) string            { return string('a' + op) }
+func (glyphs) RandomOp(r *rand.Rand) uint8      { return 0 }
+
+func TestPmod(t *testing.T) {
+	assert.Equal(t, Pmod(5, 4), 1)
+	assert.Equal(t, Pmod(-1, 4), 3)
+	assert.Equal(t, Pmod(-8, 4), 0)
+}
+
+func TestSignExtend(t *testing.T) {
+	assert.Equal(t, SignExtend(0x07), int8(7))
+	assert.Equal(t, SignExtend(0x08), int8(-8))
+	assert.Equal(t, SignExtend(0x0f), int8(-1))
+}
+
+func TestConfigJSON(t *testing.T) {
+	c := Config{ULen: 16, Strict: true}
+	extra := struct {
+		Food int `json:"food"`
+	}{3}
+	j, err := ConfigJSON(&c, &extra)
+	assert.NilError(t, err)
+
+	var m map[string]any
+	assert.NilError(t, json.Unmarshal(j, &m))
+	assert.Equal(t, m["ulen"], 16.0)
+	assert.Equal(t, m["strict"], true)
+	assert.Equal(t, m["food"], 3.0)
+}
+
+// Flags on any FlagSet go on top of the run file
+func TestParseFlags(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "run.json")
+	assert.NilError(t, os.WriteFile(name, []byte(`{"ulen": 64, "slen": 8}`), 0o644))
+	c := Config{ULen: 16, SLen: 4}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	assert.NilError(t, ParseFlags(fs, []string{"-config", name, "-slen", "32", "-seed", "5", "LOG"}, &c))
+	assert.Equal(t, c.ULen, 64)
+	assert.Equal(t, c.SLen, 32)
+	assert.Equal(t, c.Seed, uint64(5))
+	assert.Equal(t, fs.Arg(0), "LOG")
+}
+
+// copier copies the cell at pc forwards by its own value, and can trace
+// and profile that. Runs of op 0 underflow.
+type copier struct{ glyphs }
+
+func (c copier) Run(universe []uint8, pc int) int { return c.RunTraced(universe, pc, nil) }
+
+func (copier) RunTraced(universe []uint8, pc int, wrote func(dst int, src int)) int {
+	dst := (pc + int(universe[pc])) % len(universe)
+	universe[dst] = universe[pc]
+	if wrote != nil {
+		wrote(dst, pc)
+	}
+	return 1
+}
+
+func (c copier) RunProfiled(universe []uint8, pc int, wrote func(dst int, src int), prof *Profile) int {
+	op := universe[pc]
+	n := c.RunTraced(universe, pc, wrote)
+	prof.Ops[op]++
+	if op == 0 {
+		prof.Halted(UNDERFLOW, op)
+	} else {
+		prof.Halted(ILIMIT, op)
+	}
+	return n
+}
+
+func (copier) RandomOp(r *rand.Rand) uint8 { return uint8(r.Intn(8)) }
+
+// fixture is a soup of isa with a random universe, which each of with
+// can change the configuration of first.
+func fixture(isa ISA, with ...func(c *Config)) *Soup {
+	c := &Config{ULen: 256, MutationRate: 10, Runners: 4, Seed: 1, Schedule: PARALLEL, Epoch: 8}
+	for _, f := range with {
+		f(c)
+	}
+	s := NewSoup(isa, c)
+	s.Universe.Randomize(s.ISA, s.Rand)
+	return s
+}
+
+// ran is a fixture after 10,240 runs.
+func ran(isa ISA, with ...func(c *Config)) *Soup {
+	s := fixture(isa, with...)
+	s.Schedule(10_240)
+	return s
+}
+
+func scheduling(schedule string) func(c *Config) {
+	return func(c *Config) { c.Schedule = schedule }
+}
+
+func seeded(seed uint64) func(c *Config) {
+	return func(c *Config) { c.Seed = seed }
+}
+
+func TestScheduleIsReproducible(t *testing.T) {
+	for _, schedule := range []string{PARALLEL, SERIAL, ROUND_ROBIN, RANDOM} {
+		a := ran(copier{}, scheduling(schedule))
+		b := ran(copier{}, scheduling(schedule))
+		c := ran(copier{}, scheduling(schedule), seeded(2))
+		assert.Equal(t, a.Generation(), uint64(10_240))
+		assert.DeepEqual(t, a.Universe, b.Universe)
+		assert.Assert(t, string(a.Universe) != string(c.Universe))
+	}
+}
+
+// None of these change what the runs do
+func TestUnchanged(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		schedule string
+		with     func(c *Config)
+	}{
+		{"serial", PARALLEL, scheduling(SERIAL)},
+		{"provenance", PARALLEL, tracing},
+		{"provenance", ROUND_ROBIN, tracing},
+		{"profile", PARALLEL, profiling},
+		{"profile", ROUND_ROBIN, profiling},
+	} {
+		t.Run(test.name+"/"+test.schedule, func(t *testing.T) {
+			want := ran(copier{}, scheduling(test.schedule), seeded(3))
+			got := ran(copier{}, scheduling(test.schedule), seeded(3), test.with)
+			assert.DeepEqual(t, got.Universe, want.Universe)
+		})
+	}
+}
+
+// TestConcurrentSnapshots is mainly for the race detector.
+func TestConcurrentSnapshots(t *testing.T) {
+	s := NewSoup(copier{}, &Config{ULen: 1024, MutationRate: 10, Runners: 8, Seed: 1, Schedule: PARALLEL, Epoch: 16})
+	done := make(chan bool)
+	go func() {
+		s.Schedule(25_600)
+		done <- true
+	}()
+
+	u := make(Universe, len(s.Universe))
+	p_generation := uint64(0)
+	for {
+		select {
+		case <-done:
+			assert.Equal(t, s.Generation(), uint64(25_600))
+			assert.Equal(t, s.NOps(), uint64(25_600))
+			return
+		default:
+			generation, n_ops := s.Snapshot(u)
+			assert.Assert(t, generation >= p_generation)
+			assert.Equal(t, generation, n_ops)
+			p_generation = generation
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := NewSoup(copier{}, &Config{ULen: 256, Runners: 4, Seed: 1, Schedule: PARALLEL, Epoch: 8, MaxGenerations: 1000})
+	s.Config.Summary = filepath.Join(t.TempDir(), "summary.json")
+	s.Schedule(0)
+	// Epochs are 32 runs, so it stops at the first one past 1000
+	assert.Equal(t, s.Generation(), uint64(1024))
+	s.finish()
+	<-s.Done()
+
+	b, err := os.ReadFile(s.Config.Summary)
+	assert.NilError(t, err)
+	var m Summary
+	assert.NilError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, m.Reason, MAX_GENERATIONS)
+	assert.Equal(t, m.Generations, uint64(1024))
+	assert.Equal(t, m.Ops, uint64(1024))
+
+	s = NewSoup(copier{}, &Config{ULen: 256, Runners: 4, Seed: 1, Schedule: ROUND_ROBIN, MaxOps: 1000})
+	s.Schedule(0)
+	assert.Equal(t, s.NOps(), uint64(1000))
+	s.Stop("late")
+	assert.Equal(t, *s.stop.Load(), MAX_OPS)
+}
+
+func TestDurationJSON(t *testing.T) {
+	c := Config{MaxDuration: Duration(90 * time.Minute)}
+	j, err := ConfigJSON(&c)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(j), `"max_duration":"1h30m0s"`))
+	var c2 Config
+	assert.NilError(t, json.Unmarshal(j, &c2))
+	assert.Equal(t, c2.MaxDuration, c.MaxDuration)
+	assert.NilError(t, json.Unmarshal([]byte(`{"max_duration": 1000}`), &c2))
+	assert.Equal(t, c2.MaxDuration, Duration(1000))
+}
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, Universe{1, 1, 1, 1}.Entropy(), 0.0)
+	assert.Equal(t, Universe{0, 1, 2, 3}.Entropy(), 2.0)
+	assert.Equal(t, Universe{0, 0, 1, 1}.Entropy(), 1.0)
+}
+
+func TestStatsOut(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"stats.jsonl", "stats.csv"} {
+		s := NewSoup(copier{}, &Config{ULen: 4, Runners: 1})
+		s.Universe = Universe{0, 1, 2, 3}
+		w, err := NewStatsWriter(filepath.Join(dir, name), false)
+		assert.NilError(t, err)
+		s.stats = w
+		s.Sample(s.Universe, 10, 20)
+		st := s.Sample(s.Universe, 30, 100)
+		assert.Equal(t, st.Generations, uint64(20))
+		assert.Equal(t, st.OpsPerRun, 4.0)
+		assert.NilError(t, w.Close())
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NilError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if name == "stats.csv" {
+			assert.Equal(t, len(lines), 3)
+			assert.Assert(t, strings.HasPrefix(lines[0], "time,generation,n_ops,"))
+			assert.Equal(t, len(strings.Split(lines[2], ",")), 11+256)
+		} else {
+			assert.Equal(t, len(lines), 2)
+			var st2 Stats
+			assert.NilError(t, json.Unmarshal([]byte(lines[1]), &st2))
+			assert.Equal(t, st2.Entropy, 2.0)
+			assert.Equal(t, st2.Histogram[3], 1)
+		}
+	}
+}
+
+func TestCompressedBits(t *testing.T) {
+	u := make(Universe, 65536)
+	assert.Assert(t, u.CompressedBits() < 0.1)
+	u.Randomize(copier{}, rand.New(1))
+	// Random ops from 8 have 3 bits of entropy and no order
+	assert.Assert(t, u.CompressedBits() > 3, "%f", u.CompressedBits())
+	assert.Assert(t, u.HighOrderEntropy() < 0.1, "%f", u.HighOrderEntropy())
+	for i := 0; i < len(u); i++ {
+		u[i] = u[i%64]
+	}
+	assert.Assert(t, u.HighOrderEntropy() > 2.5, "%f", u.HighOrderEntropy())
+
+	v := append(Universe{}, u...)
+	v[7]++
+	v[100]++
+	assert.Equal(t, Changes(u, v), 2)
+}
+
+func TestDetector(t *testing.T) {
+	var d detector
+	h := []float64{0.1, -0.1, 0.1, -0.1, 0.5, 0.2, 1.5, 3, 4}
+	for i, v := range h {
+		e := d.add(&Stats{Generation: uint64(i), HighOrder: v}, 4, 1)
+		if i == 6 {
+			assert.Assert(t, e != nil)
+			assert.Equal(t, e.Generation, uint64(6))
+			assert.Equal(t, e.Baseline, (-0.1+0.1+0.5+0.2)/4)
+		} else {
+			assert.Assert(t, e == nil, "sample %d", i)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package soup
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats describes the soup at one moment, and how it got there from the
+// previous sample.
+type Stats struct {
+	Time       time.Time `json:"time"`
+	Generation uint64    `json:"generation"`
+	NOps       uint64    `json:"n_ops"`
+
+	// Since the previous sample
+	Generations uint64  `json:"generations"`
+	Ops         uint64  `json:"ops"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	OpsPerRun   float64 `json:"ops_per_run"`
+
+	Entropy        float64  `json:"entropy"`         // Bits per cell
+	CompressedBits float64  `json:"compressed_bits"` // Per cell
+	HighOrder      float64  `json:"high_order"`      // Entropy - CompressedBits
+	Emerged        bool     `json:"emerged,omitempty"`
+	Histogram      [256]int `json:"histogram"`
+	Profile        *Profile `json:"profile,omitempty"` // Of the runs since the previous sample
+}
+
+// StatsWriter writes a stream of Stats, as CSV if its name ends in .csv and
+// as JSON lines otherwise. A CSV stream has the profile's columns if it was
+// made for one.
+type StatsWriter struct {
+	f       *os.File
+	w       *bufio.Writer
+	csv     *csv.Writer
+	profile bool
+}
+
+func NewStatsWriter(name string, profile bool) (*StatsWriter, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w := &StatsWriter{f: f, w: bufio.NewWriter(f), profile: profile}
+	if strings.HasSuffix(name, ".csv") {
+		w.csv = csv.NewWriter(w.w)
+		header := []string{"time", "generation", "n_ops", "generations", "ops", "ops_per_sec", "ops_per_run", "entropy", "compressed_bits", "high_order", "emerged"}
+		for op := 0; op < 256; op++ {
+			header = append(header, fmt.Sprintf("op_%02x", op))
+		}
+		if profile {
+			header = append(header, "runs")
+			for h := Halt(0); h < HALTS; h++ {
+				header = append(header, "halt_"+h.String())
+			}
+			for op := 0; op < 256; op++ {
+				header = append(header, fmt.Sprintf("exec_%02x", op))
+			}
+			for op := 0; op < 256; op++ {
+				header = append(header, fmt.Sprintf("error_%02x", op))
+			}
+			for i := 0; i < LENGTHS; i++ {
+				header = append(header, fmt.Sprintf("len_%02d", i))
+			}
+		}
+		w.csv.Write(header)
+	}
+	return w, nil
+}
+
+// Write writes a record and flushes it, so the stream can be followed.
+func (w *StatsWriter) Write(st *Stats) error {
+	if w.csv != nil {
+		f := func(v float64) string {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		record := []string{
+			st.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(st.Generation, 10),
+			strconv.FormatUint(st.NOps, 10),
+			strconv.FormatUint(st.Generations, 10),
+			strconv.FormatUint(st.Ops, 10),
+			f(st.OpsPerSec),
+			f(st.OpsPerRun),
+			f(st.Entropy),
+			f(st.CompressedBits),
+			f(st.HighOrder),
+			strconv.FormatBool(st.Emerged),
+		}
+		for _, c := range st.Histogram {
+			record = append(record, strconv.Itoa(c))
+		}
+		if w.profile {
+			p := st.Profile
+			if p == nil {
+				p = &Profile{}
+			}
+			u := func(v uint64) string {
+				return strconv.FormatUint(v, 10)
+			}
+			record = append(record, u(p.Runs))
+			for _, c := range p.Halts {
+				record = append(record, u(c))
+			}
+			for _, c := range p.Ops {
+				record = append(record, u(c))
+			}
+			for _, c := range p.Errors {
+				record = append(record, u(c))
+			}
+			for _, c := range p.Lengths {
+				record = append(record, u(c))
+			}
+		}
+		w.csv.Write(record)
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	} else {
+		b, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		w.w.Write(b)
+		w.w.WriteByte('\n')
+	}
+	return w.w.Flush()
+}
+
+func (w *StatsWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Sample computes the stats for a snapshot, watches them for emergence,
+// writes them to the stats stream if there is one and returns them.
+func (s *Soup) Sample(u Universe, generation uint64, n_ops uint64) *Stats {
+	s.stats_mu.Lock()
+	defer s.stats_mu.Unlock()
+	st := &Stats{
+		Time:        time.Now(),
+		Generation:  generation,
+		NOps:        n_ops,
+		Generations: generation - s.p_generation,
+		Ops:         n_ops - s.p_n_ops,
+		Histogram:   u.Histogram(),
+	}
+	st.Entropy = Entropy(st.Histogram, len(u))
+	st.CompressedBits = u.CompressedBits()
+	st.HighOrder = st.Entropy - st.CompressedBits
+	if !s.p_time.IsZero() {
+		st.OpsPerSec = float64(st.Ops) / st.Time.Sub(s.p_time).Seconds()
+	}
+	if st.Generations != 0 {
+		st.OpsPerRun = float64(st.Ops) / float64(st.Generations)
+	}
+	s.p_time, s.p_generation, s.p_n_ops = st.Time, generation, n_ops
+	if p := s.Profile(); p != nil {
+		st.Profile = p.Sub(&s.p_profile)
+		s.p_profile = *p
+	}
+	if e := s.detector.add(st, s.Config.EmergeWindow, s.Config.EmergeJump); e != nil {
+		st.Emerged = true
+		s.emerge(e)
+	}
+
+	if s.stats != nil {
+		if err := s.stats.Write(st); err != nil {
+			fmt.Fprintln(os.Stderr, "stats:", err)
+		}
+	}
+	return st
+}
@@ -0,0 +1,157 @@
+package soup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Reasons a run stops.
+const (
+	MAX_GENERATIONS = "max-generations"
+	MAX_OPS         = "max-ops"
+	MAX_DURATION    = "max-duration"
+)
+
+// Summary is written when a run finishes. The rates are for this process
+// alone, so a resumed run doesn't count the time it spent in earlier ones.
+type Summary struct {
+	Config     json.RawMessage `json:"config"`
+	Log        string          `json:"log,omitempty"`
+	Reason     string          `json:"reason"`
+	Generation uint64          `json:"generation"`
+	NOps       uint64          `json:"n_ops"`
+	Emergence  *Emergence      `json:"emergence,omitempty"`
+	Profile    *Profile        `json:"profile,omitempty"`
+
+	Start             time.Time `json:"start"`
+	End               time.Time `json:"end"`
+	WallTime          float64   `json:"wall_time"` // Seconds
+	Generations       uint64    `json:"generations"`
+	Ops               uint64    `json:"ops"`
+	GenerationsPerSec float64   `json:"generations_per_sec"`
+	OpsPerSec         float64   `json:"ops_per_sec"`
+}
+
+// Stop asks the scheduler to stop at the end of the current run or epoch.
+// The first reason given is the one that is kept.
+func (s *Soup) Stop(reason string) {
+	s.stop.CompareAndSwap(nil, &reason)
+}
+
+// Done is closed once the run has stopped and the final frame, checkpoint
+// and summary have been written. The log is left open for its owner to
+// close.
+func (s *Soup) Done() <-chan struct{} {
+	return s.done
+}
+
+// stopping reports whether the run should stop, checking the limits.
+func (s *Soup) stopping() bool {
+	c := s.Config
+	switch {
+	case c.MaxGenerations != 0 && s.Generation() >= c.MaxGenerations:
+		s.Stop(MAX_GENERATIONS)
+	case c.MaxOps != 0 && s.NOps() >= c.MaxOps:
+		s.Stop(MAX_OPS)
+	case c.MaxDuration != 0 && time.Since(s.started) >= time.Duration(c.MaxDuration):
+		s.Stop(MAX_DURATION)
+	}
+	return s.stop.Load() != nil
+}
+
+// finish logs the final frame and stats, checkpoints if checkpointing and
+// writes the lineage and summary. The runners must have stopped.
+func (s *Soup) finish() {
+	if s.Log != nil {
+		if g, ok := s.Log.Generation(); !ok || g != s.Generation() {
+			s.Log.DumpFields(s.Generation(), s.NOps(), s.Universe, s.fieldValues()...)
+		}
+	}
+	if s.Config.CheckpointEvery != 0 {
+		if err := s.WriteCheckpoint(); err != nil {
+			fmt.Fprintln(os.Stderr, "checkpoint:", err)
+		}
+	}
+	if s.stats != nil {
+		s.Sample(s.Universe, s.Generation(), s.NOps())
+		s.stats_mu.Lock()
+		if err := s.stats.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "stats:", err)
+		}
+		// The monitor may still be sampling
+		s.stats = nil
+		s.stats_mu.Unlock()
+	}
+	if s.Config.LineageOut != "" {
+		if err := s.WriteLineage(s.Config.LineageOut); err != nil {
+			fmt.Fprintln(os.Stderr, "lineage:", err)
+		}
+	}
+	if err := s.WriteSummary(); err != nil {
+		fmt.Fprintln(os.Stderr, "summary:", err)
+	}
+	close(s.done)
+}
+
+// Summarize summarizes the run so far.
+func (s *Soup) Summarize() (*Summary, error) {
+	j, err := ConfigJSON(s.Config)
+	if err != nil {
+		return nil, err
+	}
+	m := &Summary{
+		Config: j,
+		Start:  s.started,
+		End:    time.Now(),
+	}
+	if r := s.stop.Load(); r != nil {
+		m.Reason = *r
+	}
+	if s.Log != nil {
+		m.Log = s.Log.Name()
+	}
+	m.Emergence = s.Emergence()
+	m.Profile = s.Profile()
+	s.mu.RLock()
+	m.Generation, m.NOps = s.Generation(), s.NOps()
+	s.mu.RUnlock()
+	m.Generations = m.Generation - s.start_gen
+	m.Ops = m.NOps - s.start_n_ops
+	m.WallTime = m.End.Sub(m.Start).Seconds()
+	if m.WallTime > 0 {
+		m.GenerationsPerSec = float64(m.Generations) / m.WallTime
+		m.OpsPerSec = float64(m.Ops) / m.WallTime
+	}
+	return m, nil
+}
+
+// SummaryName is where the summary is written: Config.Summary, or beside
+// the log.
+func (s *Soup) SummaryName() string {
+	if s.Config.Summary != "" {
+		return s.Config.Summary
+	}
+	if s.Log == nil {
+		return ""
+	}
+	return s.Log.Name() + ".summary.json"
+}
+
+// WriteSummary writes the summary to SummaryName, if there is one.
+func (s *Soup) WriteSummary() error {
+	name := s.SummaryName()
+	if name == "" {
+		return nil
+	}
+	m, err := s.Summarize()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(b, '\n'), 0666)
+}
@@ -0,0 +1,152 @@
+package soup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stepper is an ISA that can run a program a step at a time, with exactly
+// the semantics of its Run, for tracing and debugging runs.
+type Stepper interface {
+	// Machine starts the program at pc, with wrote as for RunTraced.
+	Machine(universe []uint8, pc int, wrote func(dst int, src int)) Machine
+}
+
+// Machine is a program part way through a run.
+type Machine interface {
+	// Step runs the op at the pc, reporting whether the program carries
+	// on. Like Run it counts the iteration that hits the limit, which runs
+	// no op.
+	Step() bool
+	State() State
+	// SetState changes the machine between steps, as a debugger does.
+	// Values put on the stack count as computed, for RunTraced's src.
+	SetState(s State) error
+}
+
+// State is a Machine between steps.
+type State struct {
+	PC         int
+	Stack      []int8 // In use, bottom first
+	Heads      []int  // Of the ISAs that have them
+	Iterations int
+	Halted     bool
+	Halt       Halt // Why, once Halted
+}
+
+// TraceStep is a step of a traced run: the op at PC, and the stack, heads
+// and cells written after it. The last step has Halt set, and ran no op if
+// the run hit the iteration limit.
+type TraceStep struct {
+	Step   int     `json:"step"`
+	PC     int     `json:"pc"`
+	Op     uint8   `json:"op"`
+	Stack  []int8  `json:"stack,omitempty"`
+	Heads  []int   `json:"heads,omitempty"`
+	Writes []Write `json:"writes,omitempty"`
+	Halt   string  `json:"halt,omitempty"`
+}
+
+// Write is a cell written by a step.
+type Write struct {
+	Dst   int   `json:"dst"`
+	Src   int   `json:"src"` // -1 if computed
+	Value uint8 `json:"value"`
+}
+
+// StepTracer runs a program a step at a time, recording what each step
+// did. Its Machine can be changed between steps.
+type StepTracer struct {
+	Machine
+	universe []uint8
+	writes   []Write
+	steps    int
+}
+
+// NewStepTracer starts the program at pc in universe.
+func NewStepTracer(isa ISA, universe []uint8, pc int) (*StepTracer, error) {
+	st, ok := isa.(Stepper)
+	if !ok {
+		return nil, fmt.Errorf("%T can't run a step at a time", isa)
+	}
+	t := &StepTracer{universe: universe}
+	t.Machine = st.Machine(universe, pc, func(dst int, src int) {
+		t.writes = append(t.writes, Write{dst, src, universe[dst]})
+	})
+	return t, nil
+}
+
+// Next runs a step, returning what it did and whether the program carries
+// on.
+func (t *StepTracer) Next() (*TraceStep, bool) {
+	t.steps++
+	ts := &TraceStep{Step: t.steps, PC: t.State().PC}
+	ts.Op = t.universe[ts.PC]
+	t.writes = nil
+	more := t.Step()
+	s := t.State()
+	ts.Stack, ts.Heads, ts.Writes = s.Stack, s.Heads, t.writes
+	if !more {
+		ts.Halt = s.Halt.String()
+	}
+	return ts, more
+}
+
+// Trace runs the program at pc in universe, calling step after each step,
+// until it halts or step returns an error.
+func Trace(isa ISA, universe []uint8, pc int, step func(t *TraceStep) error) error {
+	t, err := NewStepTracer(isa, universe, pc)
+	if err != nil {
+		return err
+	}
+	for {
+		ts, more := t.Next()
+		if err := step(ts); err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// Format gives the step as a line of text, without a newline, with the op
+// named by name.
+func (t *TraceStep) Format(name func(op uint8) string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%6d %6d %02x %-16s", t.Step, t.PC, t.Op, name(t.Op))
+	if t.Heads != nil {
+		fmt.Fprintf(&b, " heads %v", t.Heads)
+	}
+	if t.Stack != nil {
+		fmt.Fprintf(&b, " stack %v", t.Stack)
+	}
+	for _, wr := range t.Writes {
+		fmt.Fprintf(&b, " [%d]=%02x", wr.Dst, wr.Value)
+		if wr.Src >= 0 {
+			fmt.Fprintf(&b, "<-[%d]", wr.Src)
+		}
+	}
+	if t.Halt != "" {
+		fmt.Fprintf(&b, " halt %s", t.Halt)
+	}
+	return b.String()
+}
+
+// TraceWriter returns a step function for Trace writing each step to w, as
+// a line of JSON or, without jsonl, as text with the op named by name. Call
+// the flush function it returns once the trace is done.
+func TraceWriter(w io.Writer, jsonl bool, name func(op uint8) string) (step func(t *TraceStep) error, flush func() error) {
+	bw := bufio.NewWriter(w)
+	if jsonl {
+		enc := json.NewEncoder(bw)
+		return func(t *TraceStep) error { return enc.Encode(t) }, bw.Flush
+	}
+	return func(t *TraceStep) error {
+		_, err := bw.WriteString(t.Format(name) + "\n")
+		return err
+	}, bw.Flush
+}